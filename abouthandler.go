@@ -94,9 +94,13 @@ var httpResponses = map[int]string{
 
 // AboutResponse exposes standard environment
 type AboutResponse struct {
-	J8a      string
-	ServerID string
-	Version  string
+	J8a       string
+	ServerID  string
+	Version   string
+	Upstreams []UpstreamHealth   `json:",omitempty"`
+	Ejections []UpstreamEjection `json:",omitempty"`
+	Reload    *ConfigReload      `json:",omitempty"`
+	State     State              `json:",omitempty"`
 }
 
 // StatusCodeResponse defines a JSON structure for a canned HTTP response
@@ -151,6 +155,20 @@ func RandomHuttese() string {
 }
 
 func aboutHandler(w http.ResponseWriter, r *http.Request) {
+	rt := requestRuntime(r)
+	sendEncodedResponse(w, r, 200, "ok", applicationJSON, func() []byte {
+		return AboutResponse{
+			Upstreams: rt.HealthChecks.report(),
+			Ejections: rt.Outliers.report(),
+			Reload:    rt.Reloader.lastReload(),
+			State:     rt.StateHandler.current(),
+		}.AsJSON()
+	})
+}
+
+// sendEncodedResponse sends a response body rendered by j8a itself, i.e. for /about, /metrics and probes, encoded as
+// the user agent accepts it.
+func sendEncodedResponse(w http.ResponseWriter, r *http.Request, code int, message string, ctype string, render func() []byte) {
 	proxy := new(Proxy).
 		parseIncoming(r).
 		setOutgoing(w)
@@ -161,10 +179,10 @@ func aboutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	proxy.writeStandardResponseHeaders()
-	proxy.respondWith(200, "ok")
+	proxy.respondWith(code, message)
 
-	res := AboutResponse{}.AsJSON()
-	w.Header().Set(contentType, applicationJSON)
+	res := render()
+	w.Header().Set(contentType, ctype)
 	if proxy.Dwn.AcceptEncoding.isCompatible(EncIdentity) {
 		proxy.Dwn.Resp.Body = &res
 		proxy.Dwn.Resp.ContentEncoding = EncIdentity
@@ -3,6 +3,7 @@ package j8a
 import (
 	"bytes"
 	"github.com/andybalholm/brotli"
+	"io"
 	"io/ioutil"
 	"sync"
 )
@@ -40,6 +41,19 @@ func BrotliEncode(input []byte) *[]byte {
 	return &enc
 }
 
+// BrotliEncodeStream returns a pooled brotli writer that encodes into w as data arrives.
+// Close it to finish the stream, then hand it back with ReleaseBrotliEncodeStream.
+func BrotliEncodeStream(w io.Writer) *brotli.Writer {
+	wrt, _ := brotliEncPool.Get().(*brotli.Writer)
+	wrt.Reset(w)
+	return wrt
+}
+
+// ReleaseBrotliEncodeStream returns a closed brotli writer to the pool.
+func ReleaseBrotliEncodeStream(wrt *brotli.Writer) {
+	brotliEncPool.Put(wrt)
+}
+
 // BrotliDecode decodes a []byte from Brotli binary format
 func BrotliDecode(input []byte) *[]byte {
 	rd, _ := brotliDecPool.Get().(*brotli.Reader)
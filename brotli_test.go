@@ -169,3 +169,24 @@ func BenchmarkBrotliEncode32MB(b *testing.B) {
 func BenchmarkBrotliDecode32MB(b *testing.B) {
 	BenchmahkBrotliDecodeNBytes(b, 2<<24)
 }
+
+func TestBrotliEncodeStreamThenBrotliDecode(t *testing.T) {
+	json := []byte(`{"key":"value","chunks":["one","two","three"]}`)
+
+	var buf bytes.Buffer
+	wrt := BrotliEncodeStream(&buf)
+	for i := 0; i < len(json); i += 8 {
+		end := i + 8
+		if end > len(json) {
+			end = len(json)
+		}
+		wrt.Write(json[i:end])
+		wrt.Flush()
+	}
+	wrt.Close()
+	ReleaseBrotliEncodeStream(wrt)
+
+	if c := bytes.Compare(json, *BrotliDecode(buf.Bytes())); c != 0 {
+		t.Error("decoded brotli stream is not equal to original")
+	}
+}
@@ -0,0 +1,232 @@
+package j8a
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CircuitBreaker params stop traffic to failing upstream URLs for a while instead of waiting for their timeouts.
+type CircuitBreaker struct {
+	// FailureRatio of failed upstream attempts inside the window that opens the breaker, between 0 and 1. Defaults to 0.5
+	FailureRatio float64
+
+	// MinRequests is the minimum number of upstream attempts inside the window before the breaker may open. Defaults to 20
+	MinRequests int
+
+	// WindowSeconds is the period over which attempts are counted while closed. Defaults to 10
+	WindowSeconds int
+
+	// Window is WindowSeconds as a duration. Takes precedence over WindowSeconds.
+	Window Duration
+
+	// OpenSeconds is the period an open breaker fails fast before it lets probes through. Defaults to 30
+	OpenSeconds int
+
+	// Open is OpenSeconds as a duration. Takes precedence over OpenSeconds.
+	Open Duration
+
+	// HalfOpenProbes is the number of successful probes needed to close the breaker again. Defaults to 1
+	HalfOpenProbes int
+}
+
+func (cb CircuitBreaker) windowDuration() time.Duration {
+	return durationOrSeconds(cb.Window, cb.WindowSeconds)
+}
+
+func (cb CircuitBreaker) openDuration() time.Duration {
+	return durationOrSeconds(cb.Open, cb.OpenSeconds)
+}
+
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"
+	breakerOpen     breakerState = "open"
+	breakerHalfOpen breakerState = "half-open"
+)
+
+// CircuitBreakers keeps one breaker per upstream URL.String().
+type CircuitBreakers struct {
+	lock     sync.Mutex
+	params   CircuitBreaker
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	state       breakerState
+	successes   int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int
+	probeOks    int
+}
+
+const upBreaker = "upBreaker"
+const upstreamBreakerOpened = "upstream circuit breaker opened after %d/%d failed attempts"
+const upstreamBreakerReopened = "upstream circuit breaker re-opened after failed half-open probe"
+const upstreamBreakerHalfOpen = "upstream circuit breaker half-open, probing upstream"
+const upstreamBreakerClosed = "upstream circuit breaker closed after %d successful probes"
+
+// NewCircuitBreakers creates breakers with validated params.
+func NewCircuitBreakers(params CircuitBreaker) *CircuitBreakers {
+	return &CircuitBreakers{
+		params:   params,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+func (runtime *Runtime) initCircuitBreakers() *Runtime {
+	if runtime.Connection.Upstream.CircuitBreaker != nil {
+		runtime.CircuitBreakers = NewCircuitBreakers(*runtime.Connection.Upstream.CircuitBreaker)
+	}
+	return runtime
+}
+
+func (cbs *CircuitBreakers) get(u URL) *breaker {
+	b, ok := cbs.breakers[u.String()]
+	if !ok {
+		b = &breaker{state: breakerClosed, windowStart: time.Now()}
+		cbs.breakers[u.String()] = b
+	}
+	return b
+}
+
+func (cbs *CircuitBreakers) openDuration() time.Duration {
+	return cbs.params.openDuration()
+}
+
+// isAvailable tells if the upstream URL may be chosen without taking a half-open probe slot.
+func (cbs *CircuitBreakers) isAvailable(u URL) bool {
+	if cbs == nil {
+		return true
+	}
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	b := cbs.get(u)
+	switch b.state {
+	case breakerOpen:
+		return time.Since(b.openedAt) >= cbs.openDuration()
+	case breakerHalfOpen:
+		return b.probes < cbs.params.HalfOpenProbes
+	}
+	return true
+}
+
+// allow admits an upstream attempt. Open breakers turn half-open once the open period passed, then admit up to
+// HalfOpenProbes attempts at a time.
+func (cbs *CircuitBreakers) allow(u URL) bool {
+	if cbs == nil {
+		return true
+	}
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	b := cbs.get(u)
+	if b.state == breakerOpen {
+		if time.Since(b.openedAt) < cbs.openDuration() {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probes = 0
+		b.probeOks = 0
+		log.Info().
+			Str(upResource, u.String()).
+			Str(upBreaker, string(b.state)).
+			Msg(upstreamBreakerHalfOpen)
+	}
+	if b.state == breakerHalfOpen {
+		if b.probes >= cbs.params.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// admitUpstreamAttempt asks the circuit breaker of the current attempt's URL for admission. Rejected attempts are
+// remapped to other upstreams of the route until one admits them.
+func (proxy *Proxy) admitUpstreamAttempt() bool {
+	cbs := proxy.runtime().CircuitBreakers
+	rejected := make(map[URL]bool)
+	for !cbs.allow(*proxy.Up.Atmpt.URL) {
+		scaffoldUpAttemptLog(proxy).
+			Msg(upstreamCircuitBreakerOpen)
+		rejected[*proxy.Up.Atmpt.URL] = true
+		if proxy.Route == nil {
+			return false
+		}
+		url, label, mapped := proxy.Route.remapURL(proxy)
+		if !mapped || rejected[*url] {
+			return false
+		}
+		proxy.Up.Atmpt.URL, proxy.Up.Atmpt.Label = url, label
+	}
+	return true
+}
+
+// record counts the outcome of an admitted upstream attempt.
+func (cbs *CircuitBreakers) record(u URL, outcome attemptOutcome) {
+	if cbs == nil {
+		return
+	}
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	b := cbs.get(u)
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.probes--
+		switch outcome {
+		case attemptFailure:
+			b.open()
+			log.Warn().
+				Str(upResource, u.String()).
+				Str(upBreaker, string(b.state)).
+				Msg(upstreamBreakerReopened)
+		case attemptSuccess:
+			b.probeOks++
+			if b.probeOks >= cbs.params.HalfOpenProbes {
+				b.close()
+				log.Info().
+					Str(upResource, u.String()).
+					Str(upBreaker, string(b.state)).
+					Msgf(upstreamBreakerClosed, cbs.params.HalfOpenProbes)
+			}
+		}
+	case breakerClosed:
+		if time.Since(b.windowStart) > cbs.params.windowDuration() {
+			b.close()
+		}
+		switch outcome {
+		case attemptFailure:
+			b.failures++
+		case attemptSuccess:
+			b.successes++
+		}
+		total := b.successes + b.failures
+		if total >= cbs.params.MinRequests && float64(b.failures)/float64(total) >= cbs.params.FailureRatio {
+			failures := b.failures
+			b.open()
+			log.Warn().
+				Str(upResource, u.String()).
+				Str(upBreaker, string(b.state)).
+				Msgf(upstreamBreakerOpened, failures, total)
+		}
+	}
+}
+
+func (b *breaker) open() {
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+	b.successes = 0
+	b.failures = 0
+}
+
+func (b *breaker) close() {
+	b.state = breakerClosed
+	b.windowStart = time.Now()
+	b.successes = 0
+	b.failures = 0
+}
@@ -0,0 +1,135 @@
+package j8a
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensOnFailureRatio(t *testing.T) {
+	cbs := NewCircuitBreakers(CircuitBreaker{FailureRatio: 0.5, MinRequests: 4, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 1})
+	u := URL{Scheme: "http", Host: "localhost", Port: "8080"}
+
+	cbs.record(u, attemptSuccess)
+	cbs.record(u, attemptFailure)
+	cbs.record(u, attemptFailure)
+	if !cbs.allow(u) {
+		t.Error("breaker should stay closed below minimum requests")
+	}
+	cbs.record(u, attemptSuccess)
+	if cbs.allow(u) || cbs.isAvailable(u) {
+		t.Error("breaker should be open after reaching failure ratio with minimum requests")
+	}
+}
+
+func TestCircuitBreakerIgnoresDownstreamEvents(t *testing.T) {
+	cbs := NewCircuitBreakers(CircuitBreaker{FailureRatio: 0.5, MinRequests: 1, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 1})
+	u := URL{Scheme: "http", Host: "localhost", Port: "8080"}
+
+	cbs.record(u, attemptIgnored)
+	cbs.record(u, attemptIgnored)
+	if !cbs.allow(u) {
+		t.Error("breaker should not open for ignored outcomes")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	cbs := NewCircuitBreakers(CircuitBreaker{FailureRatio: 0.5, MinRequests: 1, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 2})
+	u := URL{Scheme: "http", Host: "localhost", Port: "8080"}
+
+	cbs.record(u, attemptFailure)
+	if cbs.allow(u) {
+		t.Fatal("breaker should be open")
+	}
+
+	//open period has passed
+	cbs.breakers[u.String()].openedAt = time.Now().Add(-31 * time.Second)
+	if !cbs.isAvailable(u) {
+		t.Error("breaker should be available for probes after open period")
+	}
+	if !cbs.allow(u) || !cbs.allow(u) {
+		t.Error("half-open breaker should admit probes")
+	}
+	if cbs.allow(u) {
+		t.Error("half-open breaker should not admit more than halfOpenProbes at a time")
+	}
+
+	cbs.record(u, attemptSuccess)
+	if cbs.breakers[u.String()].state != breakerHalfOpen {
+		t.Error("breaker should stay half-open until all probes succeeded")
+	}
+	cbs.record(u, attemptSuccess)
+	if cbs.breakers[u.String()].state != breakerClosed {
+		t.Error("breaker should close after successful probes")
+	}
+}
+
+func TestCircuitBreakerReopensOnFailedProbe(t *testing.T) {
+	cbs := NewCircuitBreakers(CircuitBreaker{FailureRatio: 1, MinRequests: 1, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 1})
+	u := URL{Scheme: "http", Host: "localhost", Port: "8080"}
+
+	cbs.record(u, attemptFailure)
+	cbs.breakers[u.String()].openedAt = time.Now().Add(-31 * time.Second)
+	cbs.allow(u)
+	cbs.record(u, attemptFailure)
+	if cbs.allow(u) {
+		t.Error("breaker should re-open after failed probe")
+	}
+}
+
+func TestAdmitUpstreamAttemptSkipsOpenBreaker(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.CircuitBreakers = NewCircuitBreakers(CircuitBreaker{FailureRatio: 1, MinRequests: 1, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 1})
+	open := URL{Scheme: "http", Host: "localhost", Port: "61001"}
+	closed := URL{Scheme: "http", Host: "localhost", Port: "61002"}
+	Runner.Resources["r1"] = []ResourceMapping{{Name: "r1", URL: open}, {Name: "r1", URL: closed}}
+	Runner.Config = *Runner.Config.validateLoadBalancing()
+	Runner.CircuitBreakers.record(open, attemptFailure)
+
+	route := Route{Path: "/", Resource: "r1"}
+	proxy := &Proxy{Route: &route}
+	proxy.firstAttempt(&open, defaultMsg)
+	proxy.nextAttempt()
+	proxy.Up.Atmpt.URL = &open
+
+	if !proxy.admitUpstreamAttempt() {
+		t.Fatal("retry with open breaker should be remapped to another upstream")
+	}
+	if *proxy.Up.Atmpt.URL != closed {
+		t.Errorf("retry should move to upstream with closed breaker, got %v", proxy.Up.Atmpt.URL)
+	}
+
+	Runner.CircuitBreakers.record(closed, attemptFailure)
+	proxy.Up.Atmpt.URL = &open
+	if proxy.admitUpstreamAttempt() {
+		t.Error("attempt should not be admitted if all breakers are open")
+	}
+}
+
+func TestCircuitBreakerOpenFailsFast(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.CircuitBreakers = NewCircuitBreakers(CircuitBreaker{FailureRatio: 0.5, MinRequests: 1, WindowSeconds: 10, OpenSeconds: 30, HalfOpenProbes: 1})
+	httpClient = &MockHttp{}
+	attempts := 0
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode: 503,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"key":"value"}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, _ := http.Get(server.URL)
+	if resp.StatusCode != 503 {
+		t.Errorf("open breaker should fail fast with 503, got %d", resp.StatusCode)
+	}
+	if attempts != 1 {
+		t.Errorf("open breaker should stop further upstream attempts, want 1, got %d", attempts)
+	}
+}
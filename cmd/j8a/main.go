@@ -97,10 +97,16 @@ func recovery() {
 func waitForSignal() {
 	defer recovery()
 	sig := interruptChannel()
+	term := terminateChannel()
+	hup := hangupChannel()
 	for {
 		select {
 		case <-sig:
 			panic("os signal")
+		case <-term:
+			shutdownGracefully()
+		case <-hup:
+			j8a.ReloadConfig()
 		default:
 			time.Sleep(time.Second * 1)
 		}
@@ -109,7 +115,31 @@ func waitForSignal() {
 
 func interruptChannel() chan os.Signal {
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL, syscall.SIGQUIT)
+	return sigs
+}
+
+func terminateChannel() chan os.Signal {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	return sigs
+}
+
+// shutdownGracefully drains connections and exits 0, or falls back to recovery if the drain times out.
+func shutdownGracefully() {
+	if err := j8a.Drain(); err != nil {
+		panic(fmt.Sprintf("graceful shutdown incomplete, cause: %v", err))
+	}
+	j8a.ShutDown()
+	log.Info().
+		Int("pid", os.Getpid()).
+		Msg("graceful shutdown complete, now exiting...")
+	os.Exit(0)
+}
+
+func hangupChannel() chan os.Signal {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
 	return sigs
 }
 
@@ -0,0 +1,227 @@
+package j8a
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Concurrency caps in-flight upstream requests. Requests beyond MaxInFlight wait in a bounded queue and are shed
+// with 503 once the queue is full or they waited longer than MaxQueueWait.
+type Concurrency struct {
+	// MaxInFlight is the maximum number of concurrent upstream requests.
+	MaxInFlight int
+
+	// MaxQueue is the maximum number of requests waiting for a slot. Defaults to 0, shedding requests immediately
+	MaxQueue int
+
+	// MaxQueueWait is the longest wait for a slot before the request is shed, i.e. "250ms". Defaults to 1s
+	MaxQueueWait Duration
+}
+
+const defaultMaxQueueWait = time.Second
+
+const upstreamConcurrencyShed = "upstream resource %s overloaded, request shed"
+const upstreamGlobalConcurrency = "global"
+
+// ConcurrencyLimiters hold the global and per resource limiters of a runtime.
+type ConcurrencyLimiters struct {
+	global    *concurrencyLimiter
+	resources map[string]*concurrencyLimiter
+}
+
+type concurrencyLimiter struct {
+	params Concurrency
+	slots  chan struct{}
+	queued atomic.Int64
+	shed   atomic.Int64
+}
+
+func newConcurrencyLimiter(params *Concurrency) *concurrencyLimiter {
+	if params == nil {
+		return nil
+	}
+	return &concurrencyLimiter{
+		params: *params,
+		slots:  make(chan struct{}, params.MaxInFlight),
+	}
+}
+
+// NewConcurrencyLimiters creates limiters for the global and per resource concurrency params.
+func NewConcurrencyLimiters(global *Concurrency, resources map[string]*Concurrency) *ConcurrencyLimiters {
+	cl := &ConcurrencyLimiters{
+		global:    newConcurrencyLimiter(global),
+		resources: make(map[string]*concurrencyLimiter),
+	}
+	for name, params := range resources {
+		cl.resources[name] = newConcurrencyLimiter(params)
+	}
+	return cl
+}
+
+// carryOver keeps limiters with unchanged params after a config reload so their in-flight and queued requests
+// still count.
+func (cl *ConcurrencyLimiters) carryOver(previous *ConcurrencyLimiters) *ConcurrencyLimiters {
+	if previous == nil {
+		return cl
+	}
+	for name, l := range cl.resources {
+		if p, ok := previous.resources[name]; ok && p.params == l.params {
+			cl.resources[name] = p
+		}
+	}
+	if cl.global != nil && previous.global != nil && cl.global.params == previous.global.params {
+		cl.global = previous.global
+	}
+	return cl
+}
+
+func (rt *Runtime) initConcurrencyLimiters() *Runtime {
+	rt.ConcurrencyLimiters = NewConcurrencyLimiters(rt.Connection.Upstream.Concurrency, resourceConcurrency(rt.Resources))
+	return rt
+}
+
+// resourceConcurrency collects the concurrency params of resources, keyed by resource name.
+func resourceConcurrency(resources map[string][]ResourceMapping) map[string]*Concurrency {
+	concurrency := make(map[string]*Concurrency)
+	for name, mappings := range resources {
+		for _, m := range mappings {
+			if m.Concurrency != nil {
+				concurrency[name] = m.Concurrency
+			}
+		}
+	}
+	return concurrency
+}
+
+// acquire takes a slot or waits for one in the queue. Returns false if the request was shed, or the downstream
+// request aborted or timed out while waiting.
+func (l *concurrencyLimiter) acquire(proxy *Proxy) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > int64(l.params.MaxQueue) {
+		l.queued.Add(-1)
+		l.shed.Add(1)
+		return false
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(time.Duration(l.params.MaxQueueWait))
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		l.shed.Add(1)
+	case <-proxy.Dwn.Timeout:
+		proxy.Dwn.TimeoutFlag = true
+	case <-proxy.Dwn.Aborted:
+		proxy.Dwn.AbortedFlag = true
+	}
+	return false
+}
+
+func (l *concurrencyLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// acquire takes a global slot and one of the resource. The returned func releases both.
+func (cl *ConcurrencyLimiters) acquire(proxy *Proxy, resource string) (func(), bool) {
+	if cl == nil {
+		return func() {}, true
+	}
+	if !cl.global.acquire(proxy) {
+		return nil, false
+	}
+	rl := cl.resources[resource]
+	if !rl.acquire(proxy) {
+		cl.global.release()
+		return nil, false
+	}
+	return func() {
+		rl.release()
+		cl.global.release()
+	}, true
+}
+
+// totals sums in-flight, queued and shed requests of all limiters for the stats sampler. Requests in flight hold
+// a global and a resource slot, so the global limiter counts them if there is one.
+func (cl *ConcurrencyLimiters) totals() (inFlight uint64, queued uint64, shed uint64) {
+	if cl == nil {
+		return
+	}
+	limiters := []*concurrencyLimiter{cl.global}
+	for _, l := range cl.resources {
+		limiters = append(limiters, l)
+	}
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		if cl.global == nil || l == cl.global {
+			inFlight += uint64(len(l.slots))
+		}
+		queued += uint64(l.queued.Load())
+		shed += uint64(l.shed.Load())
+	}
+	return
+}
+
+// withConcurrencyLimit sheds upstream requests with 503 once the global or resource limit and their queues are full.
+func withConcurrencyLimit(exec proxyfunc) proxyfunc {
+	return func(proxy *Proxy) {
+		release, ok := proxy.runtime().ConcurrencyLimiters.acquire(proxy, proxy.Route.Resource)
+		if !ok {
+			if proxy.hasDownstreamAbortedOrTimedout() {
+				sendStatusCodeAsJSON(proxy)
+			} else {
+				sendStatusCodeAsJSON(proxy.respondWith(503, fmt.Sprintf(upstreamConcurrencyShed, proxy.Route.Resource)))
+			}
+			return
+		}
+		defer release()
+		exec(proxy)
+	}
+}
+
+func (config Config) validateConcurrency() *Config {
+	validate := func(name string, c *Concurrency) {
+		if c.MaxInFlight <= 0 {
+			config.panic(fmt.Sprintf("concurrency for %s maxInFlight must be greater than 0, was: %d", name, c.MaxInFlight))
+		}
+		if c.MaxQueue < 0 || c.MaxQueueWait < 0 {
+			config.panic(fmt.Sprintf("concurrency for %s maxQueue and maxQueueWait must not be negative", name))
+		}
+		if c.MaxQueueWait == 0 {
+			c.MaxQueueWait = Duration(defaultMaxQueueWait)
+		}
+	}
+
+	if config.Connection.Upstream.Concurrency != nil {
+		validate(upstreamGlobalConcurrency, config.Connection.Upstream.Concurrency)
+	}
+	for name, mappings := range config.Resources {
+		var first *Concurrency
+		for _, m := range mappings {
+			if m.Concurrency == nil {
+				continue
+			}
+			validate(name, m.Concurrency)
+			if first == nil {
+				first = m.Concurrency
+			} else if *first != *m.Concurrency {
+				config.panic(fmt.Sprintf("concurrency for resource '%v' conflicts between its mappings", name))
+			}
+		}
+	}
+	return &config
+}
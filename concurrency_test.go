@@ -0,0 +1,160 @@
+package j8a
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterShedsWithoutQueue(t *testing.T) {
+	l := newConcurrencyLimiter(&Concurrency{MaxInFlight: 1, MaxQueueWait: Duration(time.Second)})
+	proxy := &Proxy{}
+
+	if !l.acquire(proxy) {
+		t.Fatal("first request should get a slot")
+	}
+	if l.acquire(proxy) {
+		t.Errorf("second request should be shed without queue")
+	}
+	if l.shed.Load() != 1 {
+		t.Errorf("want 1 shed request, got %d", l.shed.Load())
+	}
+	l.release()
+	if !l.acquire(proxy) {
+		t.Errorf("released slot should be available")
+	}
+}
+
+func TestConcurrencyLimiterQueuesUntilSlotReleased(t *testing.T) {
+	l := newConcurrencyLimiter(&Concurrency{MaxInFlight: 1, MaxQueue: 1, MaxQueueWait: Duration(time.Second * 5)})
+	proxy := &Proxy{}
+	l.acquire(proxy)
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(proxy)
+	}()
+	for l.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if l.acquire(proxy) {
+		t.Errorf("request beyond full queue should be shed")
+	}
+
+	l.release()
+	if !<-acquired {
+		t.Errorf("queued request should get the released slot")
+	}
+	if l.queued.Load() != 0 {
+		t.Errorf("queue should be empty, got %d", l.queued.Load())
+	}
+}
+
+func TestConcurrencyLimiterShedsAfterQueueWait(t *testing.T) {
+	l := newConcurrencyLimiter(&Concurrency{MaxInFlight: 1, MaxQueue: 1, MaxQueueWait: Duration(time.Millisecond * 20)})
+	proxy := &Proxy{}
+	l.acquire(proxy)
+
+	if l.acquire(proxy) {
+		t.Errorf("queued request should be shed after max queue wait")
+	}
+	if l.shed.Load() != 1 {
+		t.Errorf("want 1 shed request, got %d", l.shed.Load())
+	}
+}
+
+func TestConcurrencyLimitersGlobalAndResource(t *testing.T) {
+	cl := NewConcurrencyLimiters(&Concurrency{MaxInFlight: 2},
+		map[string]*Concurrency{"fragile": {MaxInFlight: 1}})
+	proxy := &Proxy{}
+
+	release, ok := cl.acquire(proxy, "fragile")
+	if !ok {
+		t.Fatal("first request should get slots")
+	}
+	if _, ok := cl.acquire(proxy, "fragile"); ok {
+		t.Errorf("resource limit should shed second request")
+	}
+	if _, ok := cl.acquire(proxy, "other"); !ok {
+		t.Errorf("other resource should only be bound by the global limit")
+	}
+	if _, ok := cl.acquire(proxy, "other"); ok {
+		t.Errorf("global limit should shed third request")
+	}
+
+	inFlight, _, shed := cl.totals()
+	if inFlight != 2 || shed != 2 {
+		t.Errorf("want 2 in flight and 2 shed, got %d and %d", inFlight, shed)
+	}
+	release()
+	if inFlight, _, _ = cl.totals(); inFlight != 1 {
+		t.Errorf("release should free global slot, got %d in flight", inFlight)
+	}
+}
+
+func TestConcurrencyLimitersCarryOver(t *testing.T) {
+	resources := map[string]*Concurrency{"a": {MaxInFlight: 1}, "b": {MaxInFlight: 1}}
+	previous := NewConcurrencyLimiters(nil, resources)
+
+	next := NewConcurrencyLimiters(nil, map[string]*Concurrency{"a": {MaxInFlight: 1}, "b": {MaxInFlight: 2}}).
+		carryOver(previous)
+	if next.resources["a"] != previous.resources["a"] {
+		t.Errorf("unchanged limiter should carry over")
+	}
+	if next.resources["b"] == previous.resources["b"] {
+		t.Errorf("changed limiter should be replaced")
+	}
+}
+
+func TestValidateConcurrency(t *testing.T) {
+	config := &Config{
+		Resources: map[string][]ResourceMapping{"r": {{Name: "r"}, {Name: "r", Concurrency: &Concurrency{MaxInFlight: 10}}}},
+	}
+	config = config.validateConcurrency()
+	if got := resourceConcurrency(config.Resources)["r"].MaxQueueWait; got != Duration(defaultMaxQueueWait) {
+		t.Errorf("want default max queue wait, got %v", time.Duration(got))
+	}
+
+	var tests = []struct {
+		n string
+		c Config
+	}{
+		{"no maxInFlight", Config{Resources: map[string][]ResourceMapping{"r": {{Concurrency: &Concurrency{}}}}}},
+		{"conflicting mappings", Config{Resources: map[string][]ResourceMapping{"r": {
+			{Concurrency: &Concurrency{MaxInFlight: 1}},
+			{Concurrency: &Concurrency{MaxInFlight: 2}},
+		}}}},
+		{"negative global queue", Config{Connection: Connection{Upstream: Upstream{Concurrency: &Concurrency{MaxInFlight: 1, MaxQueue: -1}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			tt.c.validateConcurrency()
+		})
+	}
+}
+
+func TestWithConcurrencyLimitSheds503(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.ConcurrencyLimiters = NewConcurrencyLimiters(&Concurrency{MaxInFlight: 1}, nil)
+	w := httptest.NewRecorder()
+	proxy := new(Proxy).
+		setOutgoing(w).
+		parseIncomingHeaders(httptest.NewRequest("GET", "/", nil))
+	proxy.Route = &Runner.Routes[0]
+
+	release, _ := Runner.ConcurrencyLimiters.acquire(proxy, proxy.Route.Resource)
+	defer release()
+
+	executed := false
+	withConcurrencyLimit(func(*Proxy) {
+		executed = true
+	})(proxy)
+	if executed || w.Code != 503 {
+		t.Errorf("request beyond global limit should be shed with 503, got %d", w.Code)
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"golang.org/x/net/idna"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,10 +31,18 @@ type Config struct {
 	Routes              Routes
 	Jwt                 map[string]*Jwt
 	Resources           map[string][]ResourceMapping
+	LoadBalancing       map[string]*LoadBalancing
+	RateLimits          map[string]*RateLimit
 	Connection          Connection
+	Tracing             *Tracing
+	Reload              *Reload
 	DisableXRequestInfo bool
 	TimeZone            string
 	LogLevel            string
+
+	routeMatcher *RouteMatcher
+	timeZone     *time.Location
+	logLevel     *zerolog.Level
 }
 
 const HTTP = "HTTP"
@@ -117,25 +128,51 @@ func (config Config) parse(yml []byte) *Config {
 	yml, _ = ioutil.ReadAll(&configTpl)
 	jsn, _ := yaml.YAMLToJSON(yml)
 
-	json.Unmarshal(jsn, &config)
+	var de *DurationError
+	if err := json.Unmarshal(jsn, &config); errors.As(err, &de) {
+		config.panic(de.Error())
+	}
 	return &config
 }
 
+var logLevels = map[string]zerolog.Level{
+	"TRACE": zerolog.TraceLevel,
+	"DEBUG": zerolog.DebugLevel,
+	"INFO":  zerolog.InfoLevel,
+	"WARN":  zerolog.WarnLevel,
+}
+
+// validateLogLevel parses the log level. It is applied with applyLogLevel once the whole config is valid.
 func (config Config) validateLogLevel() *Config {
 	logLevel := strings.ToUpper(config.LogLevel)
-	old := strings.ToUpper(zerolog.GlobalLevel().String())
 
-	if len(logLevel) > 0 && logLevel != old {
-		switch logLevel {
-		case "TRACE", "DEBUG", "INFO", "WARN":
-		default:
+	if len(logLevel) > 0 {
+		level, ok := logLevels[logLevel]
+		if !ok {
 			config.panic(fmt.Sprintf("invalid log level %v must be one of TRACE | DEBUG | INFO | WARN ", logLevel))
 		}
+		config.logLevel = &level
 	}
 
 	return &config
 }
 
+// applyLogLevel sets the global log level parsed by validateLogLevel, if configured.
+func (config Config) applyLogLevel() {
+	if config.logLevel == nil || *config.logLevel == zerolog.GlobalLevel() {
+		return
+	}
+	msg := fmt.Sprintf("resetting global log level to %v", strings.ToUpper(config.LogLevel))
+	//log at whichever of the old and new level is more verbose so the reset is visible
+	if *config.logLevel > zerolog.InfoLevel {
+		log.Info().Msg(msg)
+		zerolog.SetGlobalLevel(*config.logLevel)
+	} else {
+		zerolog.SetGlobalLevel(*config.logLevel)
+		log.Info().Msg(msg)
+	}
+}
+
 func (config Config) validateTimeZone() *Config {
 	var tz *time.Location
 	var e error
@@ -148,13 +185,21 @@ func (config Config) validateTimeZone() *Config {
 		//we default to UTC if time wasn't specified
 		tz = time.UTC
 	}
+	config.timeZone = tz
 
+	return &config
+}
+
+// applyTimeZone sets the timeZone parsed by validateTimeZone for log timestamps once the whole config is valid.
+func (config Config) applyTimeZone() {
+	tz := config.timeZone
+	if tz == nil {
+		tz = time.UTC
+	}
 	zerolog.TimestampFunc = func() time.Time {
 		return time.Now().In(tz)
 	}
 	log.Info().Msgf("timeZone for this log and all system events set to %s", tz.String())
-
-	return &config
 }
 
 func (config Config) validateResources() *Config {
@@ -192,6 +237,98 @@ func (config Config) validateResources() *Config {
 	return &config
 }
 
+func (config Config) validateHealthChecks() *Config {
+	//health state is kept per upstream URL, so all mappings of the same URL must agree on how it is probed.
+	checked := make(map[string]*HealthCheck)
+	for name := range config.Resources {
+		for _, r := range config.Resources[name] {
+			hc := r.HealthCheck
+			if hc == nil {
+				continue
+			}
+			if len(hc.Path) == 0 {
+				hc.Path = "/"
+			} else if !strings.HasPrefix(hc.Path, "/") {
+				config.panic(fmt.Sprintf("resource '%v' healthCheck path must start with /, was: %v", name, hc.Path))
+			}
+			if hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+				config.panic(fmt.Sprintf("resource '%v' healthCheck thresholds must not be negative", name))
+			}
+			key := fmt.Sprintf("resource '%v' healthCheck ", name)
+			config.resolveTimeout(key+"interval", &hc.Interval, &hc.IntervalSeconds, time.Second*10)
+			timeout := time.Second * 2
+			if timeout > hc.intervalDuration() {
+				timeout = hc.intervalDuration()
+			}
+			config.resolveTimeout(key+"timeout", &hc.Timeout, &hc.TimeoutSeconds, timeout)
+			if hc.timeoutDuration() > hc.intervalDuration() {
+				config.panic(fmt.Sprintf("resource '%v' healthCheck timeout %v must not exceed interval %v", name, hc.timeoutDuration(), hc.intervalDuration()))
+			}
+			if hc.HealthyThreshold == 0 {
+				hc.HealthyThreshold = 2
+			}
+			if hc.UnhealthyThreshold == 0 {
+				hc.UnhealthyThreshold = 3
+			}
+			for _, c := range hc.StatusCodes {
+				if c < 100 || c > 599 {
+					config.panic(fmt.Sprintf("resource '%v' healthCheck statusCodes must be between 100 and 599, was: %d", name, c))
+				}
+			}
+			if other, ok := checked[r.URL.String()]; ok && !reflect.DeepEqual(*other, *hc) {
+				config.panic(fmt.Sprintf("resource '%v' healthCheck for %v conflicts with another healthCheck for the same URL", name, r.URL.String()))
+			}
+			checked[r.URL.String()] = hc
+		}
+	}
+	return &config
+}
+
+func (config Config) validateLoadBalancing() *Config {
+	if config.LoadBalancing == nil {
+		config.LoadBalancing = make(map[string]*LoadBalancing)
+	}
+	for name, lb := range config.LoadBalancing {
+		if _, ok := config.Resources[name]; !ok {
+			config.panic(fmt.Sprintf("loadBalancing for resource '%v' but resource is not declared", name))
+		}
+		if lb == nil {
+			lb = &LoadBalancing{}
+			config.LoadBalancing[name] = lb
+		}
+		switch lb.Strategy {
+		case emptyString:
+			lb.Strategy = roundRobin
+		case roundRobin, leastOutstanding, random, weighted:
+		case consistentHash:
+			switch lb.HashOn {
+			case hashOnHeader, hashOnCookie:
+				if len(lb.HashKey) == 0 {
+					config.panic(fmt.Sprintf("loadBalancing for resource '%v' with consistentHash on %v needs hashKey", name, lb.HashOn))
+				}
+			case hashOnClientIP:
+			default:
+				config.panic(fmt.Sprintf("loadBalancing for resource '%v' with consistentHash needs hashOn header | cookie | clientIP, was: %v", name, lb.HashOn))
+			}
+		default:
+			config.panic(fmt.Sprintf("loadBalancing for resource '%v' needs strategy roundRobin | leastOutstanding | random | consistentHash | weighted, was: %v", name, lb.Strategy))
+		}
+	}
+
+	for name, mappings := range config.Resources {
+		for _, m := range mappings {
+			if m.weight() < 0 {
+				config.panic(fmt.Sprintf("resource '%v' weight must not be negative, was: %v", name, m.weight()))
+			}
+		}
+		if _, ok := config.LoadBalancing[name]; !ok {
+			config.LoadBalancing[name] = &LoadBalancing{Strategy: roundRobin}
+		}
+		config.LoadBalancing[name].balancer = NewLoadBalancer(*config.LoadBalancing[name])
+	}
+	return &config
+}
+
 func validScheme(s string) bool {
 	s = strings.TrimSpace(s)
 	s = strings.TrimSuffix(s, "://")
@@ -287,11 +424,14 @@ func (config Config) validateRoutes() *Config {
 				config.panic(fmt.Sprintf("route [%s] jwt [%s] not found, check your configuration", config.Routes[i].Path, config.Routes[i].Jwt))
 			}
 		}
+		if v, e := config.Routes[i].validRetry(); !v {
+			config.panic(e.Error())
+		}
 		if len(config.Routes[i].PathType) == 0 {
 			config.Routes[i].PathType = prefixS
 		} else {
 			if !routePathTypes.isValid(config.Routes[i].PathType) {
-				config.panic(fmt.Sprintf("path type %s invalid, not one of ['prefix', 'exact']", config.Routes[i].PathType))
+				config.panic(fmt.Sprintf("path type %s invalid, not one of ['prefix', 'exact', 'regex']", config.Routes[i].PathType))
 			}
 		}
 		if len(config.Routes[i].Host) > 0 {
@@ -299,6 +439,13 @@ func (config Config) validateRoutes() *Config {
 				config.panic(fmt.Sprintf("host pattern %s invalid, cause %v", config.Routes[i].Host, e2))
 			}
 		}
+		switch config.Routes[i].HostHeader {
+		case emptyString:
+			config.Routes[i].HostHeader = hostHeaderRewrite
+		case hostHeaderRewrite, hostHeaderPreserve:
+		default:
+			config.panic(fmt.Sprintf("route %s hostHeader %s invalid, not one of ['rewrite', 'preserve']", config.Routes[i].Path, config.Routes[i].HostHeader))
+		}
 		if len(config.Routes[i].Resource) == 0 {
 			config.panic(fmt.Sprintf("route %s must have a resource", config.Routes[i].Path))
 		} else {
@@ -320,7 +467,7 @@ func (config Config) compileRoutePaths() *Config {
 	for i, route := range config.Routes {
 		err = route.compilePath()
 		if err != nil {
-			config.panic(fmt.Sprintf("config error, illegal route path %s", route.Path))
+			config.panic(fmt.Sprintf("config error, illegal route path %s, cause %v", route.Path, err))
 		} else {
 			config.Routes[i] = route
 		}
@@ -348,6 +495,9 @@ func (config Config) compileRouteTransforms() *Config {
 		if len(config.Routes[i].Transform) > 0 && config.Routes[i].Transform[:1] != "/" {
 			config.panic(fmt.Sprintf("config error, illegal route transform %s", route.Transform))
 		}
+		if err := config.Routes[i].compileTransform(); err != nil {
+			config.panic(fmt.Sprintf("config error, illegal route transform %s, cause %v", route.Transform, err))
+		}
 	}
 	return &config
 }
@@ -434,6 +584,79 @@ func (config Config) validateHTTPConfig() *Config {
 		config.panic("cannot redirect to TLS if not properly configured.")
 	}
 
+	probes := config.Connection.Downstream.Probes
+	for _, p := range []string{probes.LivenessPath, probes.ReadinessPath} {
+		if len(p) > 0 && (!strings.HasPrefix(p, "/") || p == aboutPath || p == metricsPath) {
+			config.panic(fmt.Sprintf("connection downstream probes path must start with / and not be %s or %s, was: %v",
+				aboutPath, metricsPath, p))
+		}
+	}
+	if len(probes.LivenessPath) > 0 && probes.LivenessPath == probes.ReadinessPath {
+		config.panic("connection downstream probes livenessPath and readinessPath must be different")
+	}
+
+	if mp := config.Connection.Downstream.Metrics.Port; mp != 0 {
+		if mp < 1 || mp > 65535 {
+			config.panic(fmt.Sprintf("connection downstream metrics port must be between 1 and 65535, was: %v", mp))
+		}
+		if (config.isHTTPOn() && mp == config.Connection.Downstream.Http.Port) ||
+			(config.isTLSOn() && mp == config.Connection.Downstream.Tls.Port) {
+			config.panic("connection downstream metrics port must be different from http and tls port")
+		}
+	}
+	if config.hasDownstreamMetrics() {
+		config.validateEndpointPath("connection downstream metrics", metricsPath)
+	}
+	if len(probes.LivenessPath) > 0 {
+		config.validateEndpointPath("connection downstream probes livenessPath", probes.LivenessPath)
+	}
+	if len(probes.ReadinessPath) > 0 {
+		config.validateEndpointPath("connection downstream probes readinessPath", probes.ReadinessPath)
+	}
+
+	return &config
+}
+
+// validateEndpointPath panics if a route other than a catch-all matches the path of an endpoint served by j8a itself,
+// because the endpoint would silently take that route's traffic.
+func (config Config) validateEndpointPath(key string, path string) {
+	req := &http.Request{URL: &url.URL{Path: path}}
+	for _, route := range config.Routes {
+		if route.CompiledPathRegex == nil {
+			continue
+		}
+		if prefix, _ := route.CompiledPathRegex.LiteralPrefix(); len(prefix) > len(slashS) && route.matchURIPath(req) {
+			config.panic(fmt.Sprintf("%s path %s is matched by route %s, change the route or disable the endpoint", key, path, route.Path))
+		}
+	}
+}
+
+func (config Config) validateTracing() *Config {
+	tr := config.Tracing
+	if tr == nil {
+		return &config
+	}
+	u, err := url.Parse(tr.CollectorURL)
+	if err != nil || !(u.Scheme == "http" || u.Scheme == "https") || len(u.Host) == 0 {
+		config.panic(fmt.Sprintf("tracing collectorUrl must be an absolute http or https URL, was: %v", tr.CollectorURL))
+	}
+	if tr.BatchSize < 0 {
+		config.panic("tracing batchSize must not be negative")
+	}
+	if len(tr.ServiceName) == 0 {
+		tr.ServiceName = j8a
+	}
+	if tr.BatchSize == 0 {
+		tr.BatchSize = 512
+	}
+	config.resolveTimeout("tracing exportInterval", &tr.ExportInterval, &tr.ExportIntervalSeconds, time.Second*5)
+	return &config
+}
+
+func (config Config) validateReload() *Config {
+	if config.Reload != nil {
+		config.resolveTimeout("reload watchInterval", &config.Reload.WatchInterval, &config.Reload.WatchIntervalSeconds, 0)
+	}
 	return &config
 }
 
@@ -534,17 +757,11 @@ func (config Config) addDefaultPolicy() *Config {
 
 func (config Config) setDefaultDownstreamParams() *Config {
 
-	if config.Connection.Downstream.ReadTimeoutSeconds == 0 {
-		config.Connection.Downstream.ReadTimeoutSeconds = 5
-	}
-
-	if config.Connection.Downstream.RoundTripTimeoutSeconds == 0 {
-		config.Connection.Downstream.RoundTripTimeoutSeconds = 10
-	}
-
-	if config.Connection.Downstream.IdleTimeoutSeconds == 0 {
-		config.Connection.Downstream.IdleTimeoutSeconds = 5
-	}
+	dwn := &config.Connection.Downstream
+	config.resolveTimeout("connection downstream readTimeout", &dwn.ReadTimeout, &dwn.ReadTimeoutSeconds, time.Second*5)
+	config.resolveTimeout("connection downstream roundTripTimeout", &dwn.RoundTripTimeout, &dwn.RoundTripTimeoutSeconds, time.Second*10)
+	config.resolveTimeout("connection downstream idleTimeout", &dwn.IdleTimeout, &dwn.IdleTimeoutSeconds, time.Second*5)
+	config.resolveTimeout("connection downstream drainTimeout", &dwn.DrainTimeout, &dwn.DrainTimeoutSeconds, time.Second*30)
 
 	if config.Connection.Downstream.MaxBodyBytes == 0 {
 		//set to 2MB default value
@@ -555,6 +772,15 @@ func (config Config) setDefaultDownstreamParams() *Config {
 		config.Connection.Downstream.Http.Redirecttls = false
 	}
 
+	for _, route := range config.Routes {
+		if d := route.Downstream; d != nil {
+			if d.MaxBodyBytes < 0 {
+				config.panic(fmt.Sprintf("route %s downstream maxBodyBytes must not be negative", route.Path))
+			}
+			config.resolveTimeout(fmt.Sprintf("route %s downstream roundTripTimeout", route.Path), &d.RoundTripTimeout, &d.RoundTripTimeoutSeconds, 0)
+		}
+	}
+
 	return &config
 }
 
@@ -568,21 +794,73 @@ func (config Config) isHTTPOn() bool {
 
 func (config Config) setDefaultUpstreamParams() *Config {
 
-	if config.Connection.Upstream.SocketTimeoutSeconds == 0 {
-		config.Connection.Upstream.SocketTimeoutSeconds = 3
-	}
-	if config.Connection.Upstream.ReadTimeoutSeconds == 0 {
-		config.Connection.Upstream.ReadTimeoutSeconds = 10
-	}
-	if config.Connection.Upstream.IdleTimeoutSeconds == 0 {
-		config.Connection.Upstream.IdleTimeoutSeconds = 120
-	}
+	up := &config.Connection.Upstream
+	config.resolveTimeout("connection upstream socketTimeout", &up.SocketTimeout, &up.SocketTimeoutSeconds, time.Second*3)
+	config.resolveTimeout("connection upstream readTimeout", &up.ReadTimeout, &up.ReadTimeoutSeconds, time.Second*10)
+	config.resolveTimeout("connection upstream idleTimeout", &up.IdleTimeout, &up.IdleTimeoutSeconds, time.Second*120)
 	if config.Connection.Upstream.PoolSize == 0 {
 		config.Connection.Upstream.PoolSize = 32768
 	}
 	if config.Connection.Upstream.MaxAttempts == 0 {
 		config.Connection.Upstream.MaxAttempts = 1
 	}
+	if up.RetryBackoffBase != nil && up.RetryBackoffMax == nil {
+		backoffMax := Duration(time.Second)
+		up.RetryBackoffMax = &backoffMax
+	}
+	for _, route := range config.Routes {
+		if u := route.Upstream; u != nil {
+			if u.MaxAttempts < 0 {
+				config.panic(fmt.Sprintf("route %s upstream maxAttempts must not be negative", route.Path))
+			}
+			key := fmt.Sprintf("route %s upstream ", route.Path)
+			config.resolveTimeout(key+"socketTimeout", &u.SocketTimeout, &u.SocketTimeoutSeconds, 0)
+			config.resolveTimeout(key+"readTimeout", &u.ReadTimeout, &u.ReadTimeoutSeconds, 0)
+			config.resolveTimeout(key+"idleTimeout", &u.IdleTimeout, &u.IdleTimeoutSeconds, 0)
+		}
+	}
+	if up.retryBackoffBaseDuration() < 0 || up.retryBackoffMaxDuration() < 0 {
+		config.panic("connection upstream retryBackoffBase and retryBackoffMax must not be negative")
+	}
+	if up.retryBackoffBaseDuration() > up.retryBackoffMaxDuration() {
+		config.panic(fmt.Sprintf("connection upstream retryBackoffBase %v must not exceed retryBackoffMax %v",
+			up.retryBackoffBaseDuration(), up.retryBackoffMaxDuration()))
+	}
+	if cb := config.Connection.Upstream.CircuitBreaker; cb != nil {
+		if cb.FailureRatio < 0 || cb.FailureRatio > 1 {
+			config.panic(fmt.Sprintf("connection upstream circuitBreaker failureRatio must be between 0 and 1, was: %v", cb.FailureRatio))
+		}
+		if cb.MinRequests < 0 || cb.HalfOpenProbes < 0 {
+			config.panic("connection upstream circuitBreaker minRequests and halfOpenProbes must not be negative")
+		}
+		if cb.FailureRatio == 0 {
+			cb.FailureRatio = 0.5
+		}
+		if cb.MinRequests == 0 {
+			cb.MinRequests = 20
+		}
+		config.resolveTimeout("connection upstream circuitBreaker window", &cb.Window, &cb.WindowSeconds, time.Second*10)
+		config.resolveTimeout("connection upstream circuitBreaker open", &cb.Open, &cb.OpenSeconds, time.Second*30)
+		if cb.HalfOpenProbes == 0 {
+			cb.HalfOpenProbes = 1
+		}
+	}
+	if od := config.Connection.Upstream.OutlierDetection; od != nil {
+		if od.ConsecutiveErrors < 0 {
+			config.panic("connection upstream outlierDetection consecutiveErrors must not be negative")
+		}
+		if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+			config.panic(fmt.Sprintf("connection upstream outlierDetection maxEjectionPercent must be between 0 and 100, was: %d", od.MaxEjectionPercent))
+		}
+		if od.ConsecutiveErrors == 0 {
+			od.ConsecutiveErrors = 5
+		}
+		config.resolveTimeout("connection upstream outlierDetection baseEjection", &od.BaseEjection, &od.BaseEjectionSeconds, time.Second*30)
+		config.resolveTimeout("connection upstream outlierDetection maxEjection", &od.MaxEjection, &od.MaxEjectionSeconds, time.Second*300)
+		if od.MaxEjectionPercent == 0 {
+			od.MaxEjectionPercent = 50
+		}
+	}
 	return &config
 }
 
@@ -604,7 +882,27 @@ func (config Config) validateJwt() *Config {
 }
 
 func (config Config) getDownstreamRoundTripTimeoutDuration() time.Duration {
-	return time.Duration(time.Second * time.Duration(config.Connection.Downstream.RoundTripTimeoutSeconds))
+	return config.Connection.Downstream.roundTripTimeoutDuration()
+}
+
+// resolveTimeout validates a duration typed timeout against its legacy seconds key and falls back to def if neither
+// is set. Whole seconds are written back to the seconds key.
+func (config Config) resolveTimeout(key string, d *Duration, seconds *int, def time.Duration) {
+	if *d < 0 || *seconds < 0 {
+		config.panic(fmt.Sprintf("%s must not be negative", key))
+	}
+	if *d > 0 && *seconds > 0 && time.Duration(*d) != time.Duration(*seconds)*time.Second {
+		config.panic(fmt.Sprintf("%s %v conflicts with %sSeconds %d", key, time.Duration(*d), key, *seconds))
+	}
+	if *d == 0 {
+		*d = Duration(durationOrSeconds(0, *seconds))
+	}
+	if *d == 0 {
+		*d = Duration(def)
+	}
+	if time.Duration(*d)%time.Second == 0 {
+		*seconds = int(time.Duration(*d) / time.Second)
+	}
 }
 
 func envToMap() map[string]string {
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	isd "github.com/jbenet/go-is-domain"
 )
@@ -134,6 +135,40 @@ func TestDefaultUpstreamConnectionMaxAttempts(t *testing.T) {
 	}
 }
 
+func durationOf(d time.Duration) *Duration {
+	v := Duration(d)
+	return &v
+}
+
+// TestDefaultUpstreamRetryBackoff
+func TestDefaultUpstreamRetryBackoff(t *testing.T) {
+	config := new(Config).setDefaultUpstreamParams()
+	if up := config.Connection.Upstream; up.RetryBackoffBase != nil || up.RetryBackoffMax != nil {
+		t.Errorf("default config should not back off retries, got base %v and max %v", up.RetryBackoffBase, up.RetryBackoffMax)
+	}
+
+	config = new(Config)
+	config.Connection.Upstream.RetryBackoffBase = durationOf(0)
+	config = config.setDefaultUpstreamParams()
+	if got := config.Connection.Upstream.retryBackoffBaseDuration(); got != 0 {
+		t.Errorf("configured retry backoff base 0 should be kept, got %v", got)
+	}
+	if got := config.Connection.Upstream.retryBackoffMaxDuration(); got != time.Second {
+		t.Errorf("configured retry backoff got default max %v, want 1s", got)
+	}
+}
+
+func TestUpstreamRetryBackoffBaseExceedsMaxFails(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked with retry backoff base above max")
+		}
+	}()
+	config := new(Config)
+	config.Connection.Upstream.RetryBackoffBase = durationOf(2 * time.Second)
+	config.setDefaultUpstreamParams()
+}
+
 // TestDefaultPolicy
 func TestDefaultPolicy(t *testing.T) {
 	wantLabel := "default"
@@ -1579,3 +1614,216 @@ func TestConfigValidationPanicsForBadResource(t *testing.T) {
 
 	config = config.validateRoutes()
 }
+
+func TestValidateHealthChecksAppliesDefaults(t *testing.T) {
+	hc := &HealthCheck{}
+	config := &Config{Resources: map[string][]ResourceMapping{
+		"r1": {{URL: URL{Scheme: "http", Host: "localhost", Port: "8080"}, HealthCheck: hc}},
+	}}
+	config = config.validateHealthChecks()
+
+	if hc.Path != "/" || hc.IntervalSeconds != 10 || hc.TimeoutSeconds != 2 ||
+		hc.HealthyThreshold != 2 || hc.UnhealthyThreshold != 3 {
+		t.Errorf("health check defaults not applied, got %+v", *hc)
+	}
+}
+
+func TestValidateHealthChecksFails(t *testing.T) {
+	var tests = []struct {
+		n  string
+		hc HealthCheck
+	}{
+		{"path without slash", HealthCheck{Path: "health"}},
+		{"timeout exceeds interval", HealthCheck{IntervalSeconds: 1, TimeoutSeconds: 2}},
+		{"negative threshold", HealthCheck{UnhealthyThreshold: -1}},
+		{"bad status code", HealthCheck{StatusCodes: []int{200, 999}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked for %s", tt.n)
+				}
+			}()
+			hc := tt.hc
+			config := &Config{Resources: map[string][]ResourceMapping{
+				"r1": {{URL: URL{Scheme: "http", Host: "localhost", Port: "8080"}, HealthCheck: &hc}},
+			}}
+			config.validateHealthChecks()
+		})
+	}
+}
+
+func TestValidateHealthChecksSameURL(t *testing.T) {
+	u := URL{Scheme: "http", Host: "localhost", Port: "8080"}
+	config := &Config{Resources: map[string][]ResourceMapping{
+		"r1": {{URL: u, HealthCheck: &HealthCheck{Path: "/health"}}},
+		"r2": {{URL: u, HealthCheck: &HealthCheck{Path: "/health"}}, {URL: u}},
+	}}
+	config.validateHealthChecks()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked for conflicting health checks of the same URL")
+		}
+	}()
+	config = &Config{Resources: map[string][]ResourceMapping{
+		"r1": {{URL: u, HealthCheck: &HealthCheck{Path: "/health"}}},
+		"r2": {{URL: u, HealthCheck: &HealthCheck{Path: "/status"}}},
+	}}
+	config.validateHealthChecks()
+}
+
+func TestSetDefaultUpstreamParamsFailsNegativeRouteOverride(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked with negative route read timeout")
+		}
+	}()
+
+	config := &Config{Routes: Routes{{Path: "/report", Upstream: &RouteUpstream{ReadTimeoutSeconds: -1}}}}
+	config.setDefaultUpstreamParams()
+}
+
+func TestSetDefaultDownstreamParamsFailsNegativeRouteOverride(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked with negative route max body bytes")
+		}
+	}()
+
+	config := &Config{Routes: Routes{{Path: "/report", Downstream: &RouteDownstream{MaxBodyBytes: -1}}}}
+	config.setDefaultDownstreamParams()
+}
+
+func TestSetDefaultParamsKeepsRouteOverrides(t *testing.T) {
+	config := &Config{Routes: Routes{{Path: "/report",
+		Upstream:   &RouteUpstream{ReadTimeoutSeconds: 60, MaxAttempts: 3},
+		Downstream: &RouteDownstream{RoundTripTimeoutSeconds: 90}}}}
+	config = config.setDefaultUpstreamParams().setDefaultDownstreamParams()
+
+	if got := config.Routes[0].Upstream.ReadTimeoutSeconds; got != 60 {
+		t.Errorf("want route read timeout 60, got %d", got)
+	}
+	if got := config.Routes[0].Downstream.RoundTripTimeoutSeconds; got != 90 {
+		t.Errorf("want route round trip timeout 90, got %d", got)
+	}
+}
+
+func TestParseDurationTimeouts(t *testing.T) {
+	config := new(Config).parse([]byte(`---
+connection:
+  downstream:
+    roundTripTimeout: 1.5s
+    readTimeoutSeconds: 7
+  upstream:
+    readTimeout: 250ms
+    socketTimeout: 2
+routes:
+  - path: /report
+    resource: report
+    upstream:
+      readTimeout: 90s
+`)).setDefaultUpstreamParams().setDefaultDownstreamParams()
+
+	dwn := config.Connection.Downstream
+	if got := dwn.roundTripTimeoutDuration(); got != time.Millisecond*1500 {
+		t.Errorf("want downstream round trip timeout 1.5s, got %v", got)
+	}
+	if got := dwn.readTimeoutDuration(); got != time.Second*7 {
+		t.Errorf("want downstream read timeout 7s from seconds key, got %v", got)
+	}
+	if got := dwn.idleTimeoutDuration(); got != time.Second*5 {
+		t.Errorf("want default downstream idle timeout 5s, got %v", got)
+	}
+	up := config.Connection.Upstream
+	if got := up.readTimeoutDuration(); got != time.Millisecond*250 {
+		t.Errorf("want upstream read timeout 250ms, got %v", got)
+	}
+	if got := up.socketTimeoutDuration(); got != time.Second*2 || up.SocketTimeoutSeconds != 2 {
+		t.Errorf("want upstream socket timeout 2s for plain number, got %v", got)
+	}
+	if got := config.Routes[0].Upstream.ReadTimeout; got != Duration(time.Second*90) {
+		t.Errorf("want route upstream read timeout 90s, got %v", time.Duration(got))
+	}
+}
+
+func TestParseDurationTimeoutFailsInvalid(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked with invalid duration")
+		}
+	}()
+
+	new(Config).parse([]byte("---\nconnection:\n  upstream:\n    readTimeout: 250 parsecs\n"))
+}
+
+func TestResolveTimeoutFailsConflictingKeys(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config should have panicked with conflicting readTimeout and readTimeoutSeconds")
+		}
+	}()
+
+	config := &Config{Connection: Connection{Upstream: Upstream{ReadTimeout: Duration(time.Millisecond * 250), ReadTimeoutSeconds: 10}}}
+	config.setDefaultUpstreamParams()
+}
+
+func TestResolveTimeoutIsRepeatable(t *testing.T) {
+	config := &Config{Connection: Connection{Downstream: Downstream{RoundTripTimeout: Duration(time.Millisecond * 1500)}}}
+	config = config.setDefaultDownstreamParams().setDefaultDownstreamParams()
+
+	if got := config.Connection.Downstream.roundTripTimeoutDuration(); got != time.Millisecond*1500 {
+		t.Errorf("want round trip timeout 1.5s, got %v", got)
+	}
+}
+
+func TestParseDurationIntervals(t *testing.T) {
+	config := new(Config).parse([]byte(`---
+connection:
+  downstream:
+    drainTimeout: 2.5s
+  upstream:
+    circuitBreaker:
+      window: 500ms
+      openSeconds: 3
+    outlierDetection:
+      baseEjection: 1.5s
+resources:
+  r:
+    - url:
+        scheme: http
+        host: localhost
+        port: 60083
+      healthCheck:
+        interval: 500ms
+tracing:
+  collectorUrl: http://localhost:4318/v1/traces
+  exportInterval: 250ms
+reload:
+  watchInterval: 1.5s
+`)).validateHealthChecks().setDefaultUpstreamParams().setDefaultDownstreamParams().validateTracing().validateReload()
+
+	if got := config.Connection.Downstream.drainTimeoutDuration(); got != time.Millisecond*2500 {
+		t.Errorf("want drain timeout 2.5s, got %v", got)
+	}
+	cb := config.Connection.Upstream.CircuitBreaker
+	if cb.windowDuration() != time.Millisecond*500 || cb.openDuration() != time.Second*3 {
+		t.Errorf("want circuit breaker window 500ms and open 3s, got %v and %v", cb.windowDuration(), cb.openDuration())
+	}
+	od := config.Connection.Upstream.OutlierDetection
+	if od.baseEjectionDuration() != time.Millisecond*1500 || od.maxEjectionDuration() != time.Second*300 {
+		t.Errorf("want outlier base ejection 1.5s and max ejection 300s, got %v and %v", od.baseEjectionDuration(), od.maxEjectionDuration())
+	}
+	hc := config.Resources["r"][0].HealthCheck
+	if hc.intervalDuration() != time.Millisecond*500 || hc.timeoutDuration() != time.Millisecond*500 {
+		t.Errorf("want health check interval 500ms and timeout capped at interval, got %v and %v", hc.intervalDuration(), hc.timeoutDuration())
+	}
+	if got := config.Tracing.exportIntervalDuration(); got != time.Millisecond*250 {
+		t.Errorf("want tracing export interval 250ms, got %v", got)
+	}
+	if got := config.Reload.watchIntervalDuration(); got != time.Millisecond*1500 {
+		t.Errorf("want reload watch interval 1.5s, got %v", got)
+	}
+}
@@ -1,5 +1,12 @@
 package j8a
 
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
 // Connection Params
 type Connection struct {
 	Downstream Downstream
@@ -12,23 +19,53 @@ type Downstream struct {
 	// request, including the body, the downstream user agent sends to us.
 	ReadTimeoutSeconds int
 
+	// ReadTimeout is ReadTimeoutSeconds as a duration, i.e. "250ms". Takes precedence over ReadTimeoutSeconds.
+	ReadTimeout Duration
+
 	// WriteTimeoutSeconds is the maximum duration round trip time in seconds any
 	// single request spends in the server, this includes the time to read the request,
 	// processing upstream attempts and writing the response into downstream socket.
 	RoundTripTimeoutSeconds int
 
+	// RoundTripTimeout is RoundTripTimeoutSeconds as a duration. Takes precedence over RoundTripTimeoutSeconds.
+	RoundTripTimeout Duration
+
 	// IdleTimeoutSeconds is the maximum duration, a downstream idle socket connection is kept open
 	// before the server hangs up on the downstream user agent.
 	IdleTimeoutSeconds int
 
+	// IdleTimeout is IdleTimeoutSeconds as a duration. Takes precedence over IdleTimeoutSeconds.
+	IdleTimeout Duration
+
 	// MaxBodyBytes is the maximum size of the incoming HTTP request body before it is rejected
 	MaxBodyBytes int64
 
+	// DrainTimeoutSeconds is the maximum wait for in-flight requests and websocket sessions to complete
+	// during graceful shutdown on SIGTERM.
+	DrainTimeoutSeconds int
+
+	// DrainTimeout is DrainTimeoutSeconds as a duration. Takes precedence over DrainTimeoutSeconds.
+	DrainTimeout Duration
+
+	// IPFilter allows or denies downstream requests of all routes by client IP. Off unless configured
+	IPFilter *IPFilter
+
+	// TrustedProxies are the CIDRs of proxies in front of j8a. Only their Forwarded and X-Forwarded-For headers are
+	// used to find the client IP
+	TrustedProxies []string
+	trustedProxies []*net.IPNet
+
 	// Http block. defaults to on
 	Http Http
 
 	// Tls block defaults to off
 	Tls Tls
+
+	// Metrics block. /metrics is off unless enabled on the http and tls listeners or given its own port
+	Metrics Metrics
+
+	// Probes block for liveness and readiness endpoints
+	Probes Probes
 }
 
 type Http struct {
@@ -76,20 +113,135 @@ type Upstream struct {
 	// IdleTimeoutSeconds is the total wait period in seconds before we hang up on an idle upstream connection.
 	IdleTimeoutSeconds int
 
+	// IdleTimeout is IdleTimeoutSeconds as a duration, i.e. "90s". Takes precedence over IdleTimeoutSeconds.
+	IdleTimeout Duration
+
 	// SocketTimeoutSeconds is the wait period to establish socket connection with an upstream server.
 	// This setting controls roundtrip time for establishing simple TCP connections, combined with handshake time for TLS
 	// if applicable.
 	SocketTimeoutSeconds int
 
+	// SocketTimeout is SocketTimeoutSeconds as a duration. Takes precedence over SocketTimeoutSeconds.
+	SocketTimeout Duration
+
 	// ReadTimeoutSeconds is the wait period to read the entire upstream response once connection was established
 	// before an individual upstream request is aborted
 	ReadTimeoutSeconds int
 
+	// ReadTimeout is ReadTimeoutSeconds as a duration, i.e. "250ms". Takes precedence over ReadTimeoutSeconds.
+	ReadTimeout Duration
+
 	// MaxAttempts is the maximum allowable number of request attempts to obtain a successful response for repeatable
 	// HTTP requests.
 	MaxAttempts int
 
+	// RetryBackoffBase is the initial wait period before a retry, i.e. "50ms". It doubles with every further attempt
+	// and is randomised with full jitter. Backoff never exceeds the downstream round trip timeout. Off unless
+	// configured, 0 retries immediately
+	RetryBackoffBase *Duration
+
+	// RetryBackoffMax caps the wait period before a single retry. Defaults to 1s if RetryBackoffBase is configured
+	RetryBackoffMax *Duration
+
+	// CircuitBreaker fails fast for upstream URLs that keep failing. Off unless configured
+	CircuitBreaker *CircuitBreaker
+
+	// Concurrency caps in-flight upstream requests across all resources. Off unless configured
+	Concurrency *Concurrency
+
+	// OutlierDetection ejects upstream URLs with consecutive errors from load balancing. Off unless configured
+	OutlierDetection *OutlierDetection
+
 	// TlsInsecureSkipVerify skips the host name validation and certificate chain verification of upstream connections
 	// using TLS. Use this only for testing or if you know what you are doing. Defaults to false
 	TlsInsecureSkipVerify bool
 }
+
+func (downstream Downstream) readTimeoutDuration() time.Duration {
+	return durationOrSeconds(downstream.ReadTimeout, downstream.ReadTimeoutSeconds)
+}
+
+func (downstream Downstream) roundTripTimeoutDuration() time.Duration {
+	return durationOrSeconds(downstream.RoundTripTimeout, downstream.RoundTripTimeoutSeconds)
+}
+
+func (downstream Downstream) idleTimeoutDuration() time.Duration {
+	return durationOrSeconds(downstream.IdleTimeout, downstream.IdleTimeoutSeconds)
+}
+
+func (downstream Downstream) drainTimeoutDuration() time.Duration {
+	return durationOrSeconds(downstream.DrainTimeout, downstream.DrainTimeoutSeconds)
+}
+
+func (upstream Upstream) retryBackoffBaseDuration() time.Duration {
+	if upstream.RetryBackoffBase == nil {
+		return 0
+	}
+	return time.Duration(*upstream.RetryBackoffBase)
+}
+
+func (upstream Upstream) retryBackoffMaxDuration() time.Duration {
+	if upstream.RetryBackoffMax == nil {
+		return 0
+	}
+	return time.Duration(*upstream.RetryBackoffMax)
+}
+
+func (upstream Upstream) idleTimeoutDuration() time.Duration {
+	return durationOrSeconds(upstream.IdleTimeout, upstream.IdleTimeoutSeconds)
+}
+
+func (upstream Upstream) socketTimeoutDuration() time.Duration {
+	return durationOrSeconds(upstream.SocketTimeout, upstream.SocketTimeoutSeconds)
+}
+
+func (upstream Upstream) readTimeoutDuration() time.Duration {
+	return durationOrSeconds(upstream.ReadTimeout, upstream.ReadTimeoutSeconds)
+}
+
+// Duration is a time.Duration that parses from Go duration strings such as "250ms" or "1.5s". Plain numbers are
+// seconds.
+type Duration time.Duration
+
+// DurationError is a config value that does not parse as Duration.
+type DurationError struct {
+	Value string
+}
+
+func (e *DurationError) Error() string {
+	return fmt.Sprintf("invalid duration %s, must be a number of seconds or a duration string like \"250ms\"", e.Value)
+}
+
+// UnmarshalJSON parses a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return &DurationError{Value: string(b)}
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return &DurationError{Value: value}
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+	return &DurationError{Value: string(b)}
+}
+
+// MarshalJSON renders the duration as a string, i.e. "1.5s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// durationOrSeconds prefers a duration typed param over its legacy seconds key.
+func durationOrSeconds(d Duration, seconds int) time.Duration {
+	if d > 0 {
+		return time.Duration(d)
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,128 @@
+package j8a
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Drainer tracks listeners and hijacked websocket sessions so they can be closed gracefully.
+type Drainer struct {
+	lock     sync.Mutex
+	servers  []*http.Server
+	sessions atomic.Int64
+	draining chan struct{}
+	once     sync.Once
+}
+
+const drainPollMillis = 50
+
+const drainStarted = "graceful shutdown draining %d listener(s) and %d websocket session(s), timeout %v"
+const drainComplete = "graceful shutdown drained all connections after %s"
+const drainIncomplete = "graceful shutdown drain timeout exceeded, %d websocket session(s) remaining"
+const dwnWebsocketDraining = "downstream websocket connection closed for graceful shutdown"
+
+var errDrainTimeout = errors.New("drain timeout exceeded")
+
+// NewDrainer creates the Drainer of a runtime.
+func NewDrainer() *Drainer {
+	return &Drainer{draining: make(chan struct{})}
+}
+
+// Drain stops accepting new connections and waits for in-flight requests and websocket sessions to complete
+// within the downstream drainTimeout.
+func Drain() error {
+	if Runner == nil {
+		return nil
+	}
+	return Runner.drain()
+}
+
+func (runtime *Runtime) drain() error {
+	runtime.StateHandler.setState(Draining)
+	timeout := runtime.Connection.Downstream.drainTimeoutDuration()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return runtime.Drainer.drain(ctx, timeout)
+}
+
+// register adds a listener to shut down while draining.
+func (d *Drainer) register(server *http.Server) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.servers = append(d.servers, server)
+}
+
+// sessionStarted marks a hijacked websocket session in flight and returns the func that ends it.
+func (d *Drainer) sessionStarted() func() {
+	if d == nil {
+		return func() {}
+	}
+	d.sessions.Add(1)
+	return func() {
+		d.sessions.Add(-1)
+	}
+}
+
+// isDraining is closed once draining started. websocket sessions listen to it to send close frames.
+// Returns a nil channel that never fires if there is no Drainer.
+func (d *Drainer) isDraining() <-chan struct{} {
+	if d == nil {
+		return nil
+	}
+	return d.draining
+}
+
+func (d *Drainer) drain(ctx context.Context, timeout time.Duration) error {
+	if d == nil {
+		return nil
+	}
+	start := time.Now()
+	d.lock.Lock()
+	servers := append([]*http.Server{}, d.servers...)
+	d.lock.Unlock()
+
+	log.Info().Msgf(drainStarted, len(servers), d.sessions.Load(), timeout)
+	d.once.Do(func() {
+		close(d.draining)
+	})
+
+	//Shutdown does not wait for hijacked websocket connections, so we track them separately.
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(s *http.Server) {
+			errs <- s.Shutdown(ctx)
+		}(server)
+	}
+	var err error
+	for range servers {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+
+	ticker := time.NewTicker(time.Millisecond * drainPollMillis)
+	defer ticker.Stop()
+	for d.sessions.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			log.Warn().Msgf(drainIncomplete, d.sessions.Load())
+			return errDrainTimeout
+		case <-ticker.C:
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf(drainComplete, time.Since(start))
+	return nil
+}
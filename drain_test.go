@@ -0,0 +1,87 @@
+package j8a
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDrainCompletesInFlightRequestsAndSessions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(time.Millisecond * 200)
+		w.WriteHeader(200)
+	})}
+	go server.Serve(ln)
+
+	d := NewDrainer()
+	d.register(server)
+	endSession := d.sessionStarted()
+	go func() {
+		<-d.isDraining()
+		time.Sleep(time.Millisecond * 100)
+		endSession()
+	}()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := d.drain(ctx, time.Second*5); err != nil {
+		t.Errorf("drain should complete, got %v", err)
+	}
+	if got := <-status; got != 200 {
+		t.Errorf("in-flight request should complete during drain, got status %d", got)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Errorf("drained listener should not accept new connections")
+	}
+}
+
+func TestDrainTimesOutWithOpenWebsocketSessions(t *testing.T) {
+	d := NewDrainer()
+	d.sessionStarted()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := d.drain(ctx, 0); err != errDrainTimeout {
+		t.Errorf("want %v, got %v", errDrainTimeout, err)
+	}
+	select {
+	case <-d.isDraining():
+	default:
+		t.Errorf("websocket sessions should be told to close")
+	}
+}
+
+func TestRuntimeDrainSetsDrainingState(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.StateHandler = NewStateHandler()
+	Runner.StateHandler.setState(Daemon)
+	Runner.Drainer = NewDrainer()
+	Runner.Connection.Downstream.DrainTimeoutSeconds = 1
+
+	if err := Drain(); err != nil {
+		t.Errorf("drain without listeners should complete, got %v", err)
+	}
+	if got := Runner.StateHandler.current(); got != Draining {
+		t.Errorf("want state %v, got %v", Draining, got)
+	}
+}
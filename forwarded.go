@@ -0,0 +1,75 @@
+package j8a
+
+import (
+	"net/http"
+	"strings"
+)
+
+const xForwardedProto = "X-Forwarded-Proto"
+const xForwardedHost = "X-Forwarded-Host"
+
+const hostHeaderRewrite = "rewrite"
+const hostHeaderPreserve = "preserve"
+
+const httpScheme = "http"
+const httpsScheme = "https"
+
+// setForwardedHeaders tells the upstream about the downstream peer, scheme and original host with the RFC7239
+// Forwarded and the X-Forwarded-* headers. Inbound values are appended to if the peer is a trusted proxy and dropped
+// otherwise, so clients can't spoof them.
+func (proxy *Proxy) setForwardedHeaders(h http.Header) {
+	peer := proxy.remoteIP()
+	if !proxy.isTrustedProxy(peer) {
+		h.Del(forwarded)
+		h.Del(xForwardedFor)
+		h.Del(xForwardedProto)
+		h.Del(xForwardedHost)
+	}
+
+	proto := httpScheme
+	if proxy.Dwn.Req.TLS != nil {
+		proto = httpsScheme
+	}
+	host := proxy.Dwn.Req.Host
+
+	node := "unknown"
+	if peer != nil {
+		node = peer.String()
+	}
+	appendHeader(h, xForwardedFor, node)
+	if len(h.Get(xForwardedProto)) == 0 {
+		h.Set(xForwardedProto, proto)
+	}
+	if len(h.Get(xForwardedHost)) == 0 && len(host) > 0 {
+		h.Set(xForwardedHost, host)
+	}
+
+	element := "for=" + forwardedNode(node) + ";proto=" + proto
+	if len(host) > 0 {
+		element += ";host=" + quoteForwarded(host)
+	}
+	appendHeader(h, forwarded, element)
+}
+
+// appendHeader joins value to the existing values of key as a single comma separated list.
+func appendHeader(h http.Header, key string, value string) {
+	if values := h.Values(key); len(values) > 0 {
+		value = strings.Join(values, ", ") + ", " + value
+	}
+	h.Set(key, value)
+}
+
+// forwardedNode formats IPv6 nodes as quoted "[2001:db8::1]" per RFC7239 section 6.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, colon) {
+		return "\"[" + ip + "]\""
+	}
+	return ip
+}
+
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":[]") {
+		return "\"" + v + "\""
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package j8a
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetForwardedHeaders(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.TrustedProxies = []string{"10.0.0.0/8"}
+	Runner.Config = *Runner.Config.validateIPFilters()
+
+	var tests = []struct {
+		n       string
+		remote  string
+		tls     bool
+		inbound map[string]string
+		want    map[string]string
+	}{
+		{"untrusted peer drops inbound", "1.1.1.1:1000", false,
+			map[string]string{xForwardedFor: "6.6.6.6", xForwardedHost: "spoofed", forwarded: "for=6.6.6.6"},
+			map[string]string{
+				xForwardedFor:   "1.1.1.1",
+				xForwardedProto: "http",
+				xForwardedHost:  "example.com:8080",
+				forwarded:       `for=1.1.1.1;proto=http;host="example.com:8080"`,
+			}},
+		{"trusted peer appends inbound", "10.0.0.1:1000", true,
+			map[string]string{xForwardedFor: "2.2.2.2", xForwardedProto: "https", forwarded: "for=2.2.2.2"},
+			map[string]string{
+				xForwardedFor:   "2.2.2.2, 10.0.0.1",
+				xForwardedProto: "https",
+				forwarded:       `for=2.2.2.2, for=10.0.0.1;proto=https;host="example.com:8080"`,
+			}},
+		{"ipv6 peer", "[2001:db8::1]:1000", true, nil,
+			map[string]string{
+				xForwardedFor:   "2001:db8::1",
+				xForwardedProto: "https",
+				forwarded:       `for="[2001:db8::1]";proto=https;host="example.com:8080"`,
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com:8080/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			h := http.Header{}
+			for k, v := range tt.inbound {
+				h.Set(k, v)
+			}
+			proxy := Proxy{Dwn: Down{Req: req}}
+			proxy.setForwardedHeaders(h)
+			for k, v := range tt.want {
+				if got := h.Get(k); got != v {
+					t.Errorf("want %s %s, got %s", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScaffoldUpstreamRequestHostHeader(t *testing.T) {
+	var tests = []struct {
+		n          string
+		hostHeader string
+		want       string
+	}{
+		{"rewrite", hostHeaderRewrite, "localhost:8083"},
+		{"preserve", hostHeaderPreserve, "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			Runner = mockRuntime()
+			Runner.Routes[0].HostHeader = tt.hostHeader
+			httpClient = &MockHttp{}
+			var upHost string
+			mockDoFunc = func(req *http.Request) (*http.Response, error) {
+				upHost = req.Host
+				if len(upHost) == 0 {
+					upHost = req.URL.Host
+				}
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+				}, nil
+			}
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			w := httptest.NewRecorder()
+			(&ProxyHttpHandler{}).ServeHTTP(w, req)
+			if upHost != tt.want {
+				t.Errorf("want upstream host %s, got %s", tt.want, upHost)
+			}
+		})
+	}
+}
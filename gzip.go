@@ -3,6 +3,7 @@ package j8a
 import (
 	"bytes"
 	"github.com/klauspost/compress/gzip"
+	"io"
 	"io/ioutil"
 	"sync"
 )
@@ -42,6 +43,19 @@ func Gzip(input []byte) *[]byte {
 	return &enc
 }
 
+// GzipStream returns a pooled gzip writer that encodes into w as data arrives.
+// Close it to write the gzip footer, then hand it back with ReleaseGzipStream.
+func GzipStream(w io.Writer) *gzip.Writer {
+	wrt, _ := zipPool.Get().(*gzip.Writer)
+	wrt.Reset(w)
+	return wrt
+}
+
+// ReleaseGzipStream returns a closed gzip writer to the pool.
+func ReleaseGzipStream(wrt *gzip.Writer) {
+	zipPool.Put(wrt)
+}
+
 // Gunzip a []byte
 func Gunzip(input []byte) *[]byte {
 	rd, _ := unzipPool.Get().(*gzip.Reader)
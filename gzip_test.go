@@ -178,3 +178,27 @@ func randSeq(n int) string {
 	}
 	return string(b)
 }
+
+func TestGzipStreamThenGunzip(t *testing.T) {
+	json := []byte(`{"key":"value","chunks":["one","two","three"]}`)
+
+	var buf bytes.Buffer
+	wrt := GzipStream(&buf)
+	for i := 0; i < len(json); i += 8 {
+		end := i + 8
+		if end > len(json) {
+			end = len(json)
+		}
+		wrt.Write(json[i:end])
+		wrt.Flush()
+	}
+	wrt.Close()
+	ReleaseGzipStream(wrt)
+
+	if c := bytes.Compare(buf.Bytes()[0:2], gzipMagicBytes); c != 0 {
+		t.Errorf("gzip stream not properly encoded, want %v, got %v", gzipMagicBytes, buf.Bytes()[0:2])
+	}
+	if c := bytes.Compare(json, *Gunzip(buf.Bytes())); c != 0 {
+		t.Error("unzipped stream is not equal to original")
+	}
+}
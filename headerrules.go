@@ -0,0 +1,163 @@
+package j8a
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HeaderRules change the headers of a route. They are applied in the order remove, rename, set, add. Set and add
+// values are templates that can refer to request data: ${clientIP}, ${requestId}, ${method}, ${host},
+// ${header.<name>}, ${claim.<name>} for routes with jwt and ${path.<name>} for {name} params or named groups in the
+// route path.
+type HeaderRules struct {
+	// Add appends values to the header.
+	Add map[string]string
+	// Set replaces all values of the header.
+	Set map[string]string
+	// Remove deletes the headers.
+	Remove []string
+	// Rename moves the values of the header to a new name.
+	Rename map[string]string
+}
+
+const headerVarClientIP = "clientIP"
+const headerVarRequestID = "requestId"
+const headerVarMethod = "method"
+const headerVarHost = "host"
+const headerVarHeader = "header."
+const headerVarClaim = "claim."
+const headerVarPath = "path."
+
+var headerTemplateVar = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+func (config Config) validateHeaderRules() *Config {
+	for _, route := range config.Routes {
+		for direction, rules := range map[string]*HeaderRules{"requestHeaders": route.RequestHeaders, "responseHeaders": route.ResponseHeaders} {
+			if rules == nil {
+				continue
+			}
+			if err := rules.validate(&route); err != nil {
+				config.panic(fmt.Sprintf("route %s %s %v", route.Path, direction, err))
+			}
+		}
+	}
+	return &config
+}
+
+func (rules *HeaderRules) validate(route *Route) error {
+	names := append([]string{}, rules.Remove...)
+	for from, to := range rules.Rename {
+		names = append(names, from, to)
+	}
+	for _, templates := range []map[string]string{rules.Add, rules.Set} {
+		for name, template := range templates {
+			names = append(names, name)
+			if err := validateHeaderTemplate(route, template); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range names {
+		if len(name) == 0 || strings.ContainsAny(name, " \t:") {
+			return fmt.Errorf("invalid header name '%s'", name)
+		}
+		if !shouldProxyHeader(name) {
+			return fmt.Errorf("header %s is managed by the server and can't be changed", name)
+		}
+	}
+	return nil
+}
+
+func validateHeaderTemplate(route *Route, template string) error {
+	for _, m := range headerTemplateVar.FindAllStringSubmatch(template, -1) {
+		v := m[1]
+		switch {
+		case v == headerVarClientIP, v == headerVarRequestID, v == headerVarMethod, v == headerVarHost:
+		case strings.HasPrefix(v, headerVarHeader) && len(v) > len(headerVarHeader):
+		case strings.HasPrefix(v, headerVarClaim) && len(v) > len(headerVarClaim):
+			if !route.hasJwt() {
+				return fmt.Errorf("template variable %s needs route jwt", m[0])
+			}
+		case strings.HasPrefix(v, headerVarPath) && len(v) > len(headerVarPath):
+			if route.CompiledPathRegex == nil || route.CompiledPathRegex.SubexpIndex(v[len(headerVarPath):]) < 0 {
+				return fmt.Errorf("template variable %s needs named group in route path", m[0])
+			}
+		default:
+			return fmt.Errorf("unknown template variable %s", m[0])
+		}
+	}
+	return nil
+}
+
+// apply changes the headers h. Set and add values that render empty are skipped, so missing claims or headers
+// don't send empty values.
+func (rules *HeaderRules) apply(proxy *Proxy, h http.Header) {
+	if rules == nil {
+		return
+	}
+	for _, name := range rules.Remove {
+		h.Del(name)
+	}
+	for from, to := range rules.Rename {
+		if values := h.Values(from); len(values) > 0 {
+			values = append([]string{}, values...)
+			h.Del(from)
+			for _, v := range values {
+				h.Add(to, v)
+			}
+		}
+	}
+	for name, template := range rules.Set {
+		if v := proxy.renderHeaderTemplate(template); len(v) > 0 {
+			h.Set(name, v)
+		}
+	}
+	for name, template := range rules.Add {
+		if v := proxy.renderHeaderTemplate(template); len(v) > 0 {
+			h.Add(name, v)
+		}
+	}
+}
+
+func (proxy *Proxy) renderHeaderTemplate(template string) string {
+	return headerTemplateVar.ReplaceAllStringFunc(template, func(m string) string {
+		v := m[2 : len(m)-1]
+		switch {
+		case v == headerVarClientIP:
+			if ip := proxy.clientIP(); ip != nil {
+				return ip.String()
+			}
+		case v == headerVarRequestID:
+			return proxy.XRequestID
+		case v == headerVarMethod:
+			return proxy.Dwn.Method
+		case v == headerVarHost:
+			return proxy.Dwn.Host
+		case strings.HasPrefix(v, headerVarHeader):
+			return proxy.Dwn.Req.Header.Get(v[len(headerVarHeader):])
+		case strings.HasPrefix(v, headerVarClaim):
+			var claim interface{}
+			if proxy.token != nil && proxy.token.Get(v[len(headerVarClaim):], &claim) == nil && claim != nil {
+				return fmt.Sprint(claim)
+			}
+		case strings.HasPrefix(v, headerVarPath):
+			return proxy.pathParam(v[len(headerVarPath):])
+		}
+		return emptyString
+	})
+}
+
+// pathParam is the value of the named group in the route path matched by the downstream request.
+func (proxy *Proxy) pathParam(name string) string {
+	re := proxy.Route.CompiledPathRegex
+	i := re.SubexpIndex(name)
+	if i < 0 {
+		return emptyString
+	}
+	if m := re.FindStringSubmatch(proxy.Dwn.Req.URL.Path); m != nil {
+		return m[i]
+	}
+	return emptyString
+}
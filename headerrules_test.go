@@ -0,0 +1,131 @@
+package j8a
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestHeaderRulesApply(t *testing.T) {
+	Runner = mockRuntime()
+	req := httptest.NewRequest("GET", "/orders/42", nil)
+	req.RemoteAddr = "10.1.1.1:4000"
+	req.Header.Set("X-Tenant-Hint", "acme")
+	proxy := Proxy{
+		XRequestID: "abc",
+		Route:      &Route{CompiledPathRegex: regexp.MustCompile(`^/orders/(?P<id>[0-9]+)`)},
+		Dwn:        Down{Req: req, Method: "GET"},
+	}
+
+	rules := &HeaderRules{
+		Remove: []string{"X-Powered-By"},
+		Rename: map[string]string{"X-Old": "X-New"},
+		Set: map[string]string{
+			"X-Tenant":   "${header.X-Tenant-Hint}",
+			"X-Order":    "order-${path.id}",
+			"X-Client":   "${clientIP}/${requestId}",
+			"X-Optional": "${header.X-Missing}",
+		},
+		Add: map[string]string{"X-Multi": "two"},
+	}
+	h := http.Header{}
+	h.Set("X-Powered-By", "php")
+	h.Add("X-Old", "1")
+	h.Add("X-Old", "2")
+	h.Set("X-Multi", "one")
+	rules.apply(&proxy, h)
+
+	var tests = []struct {
+		name string
+		want []string
+	}{
+		{"X-Powered-By", nil},
+		{"X-Old", nil},
+		{"X-New", []string{"1", "2"}},
+		{"X-Tenant", []string{"acme"}},
+		{"X-Order", []string{"order-42"}},
+		{"X-Client", []string{"10.1.1.1/abc"}},
+		{"X-Optional", nil},
+		{"X-Multi", []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.Values(tt.name)
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("want %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateHeaderRulesFails(t *testing.T) {
+	route := func(path string, jwt string, rules *HeaderRules) Config {
+		r := Route{Path: path, Jwt: jwt, RequestHeaders: rules}
+		r.compilePath()
+		return Config{Routes: Routes{r}}
+	}
+	var tests = []struct {
+		n string
+		c Config
+	}{
+		{"unknown variable", route("/", "", &HeaderRules{Set: map[string]string{"X-A": "${nope}"}})},
+		{"claim without jwt", route("/", "", &HeaderRules{Set: map[string]string{"X-A": "${claim.sub}"}})},
+		{"missing path group", route("/a/(?P<id>[0-9]+)", "", &HeaderRules{Add: map[string]string{"X-A": "${path.other}"}})},
+		{"server managed header", route("/", "", &HeaderRules{Set: map[string]string{"Content-Length": "1"}})},
+		{"hop-by-hop header", route("/", "", &HeaderRules{Rename: map[string]string{"X-A": "Connection"}})},
+		{"invalid name", route("/", "", &HeaderRules{Remove: []string{"X A"}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			tt.c.validateHeaderRules()
+		})
+	}
+
+	valid := route("/a/(?P<id>[0-9]+)", "", &HeaderRules{Set: map[string]string{"X-A": "${path.id} ${method} ${host}"}})
+	valid.validateHeaderRules()
+}
+
+func TestProxyHandlerAppliesHeaderRules(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].RequestHeaders = &HeaderRules{Set: map[string]string{"X-Tenant": "${requestId}"}}
+	Runner.Routes[0].ResponseHeaders = &HeaderRules{Remove: []string{"X-Powered-By"}}
+	httpClient = &MockHttp{}
+	var upHeader http.Header
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		upHeader = req.Header
+		h := http.Header{}
+		h.Set("X-Powered-By", "php")
+		return &http.Response{
+			StatusCode: 200,
+			Header:     h,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(XRequestID, "tenant1")
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	if got := upHeader.Get("X-Tenant"); got != "tenant1" {
+		t.Errorf("want upstream X-Tenant tenant1, got %s", got)
+	}
+	if got := resp.Header.Get("X-Powered-By"); len(got) > 0 {
+		t.Errorf("X-Powered-By should be removed downstream, got %s", got)
+	}
+}
@@ -0,0 +1,229 @@
+package j8a
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HealthChecks keeps the state of active upstream probes, keyed by URL.String() of each resource mapping
+// with a healthCheck block. All mappings of a probed URL share its state, config validation rejects conflicting
+// healthChecks for the same URL. URLs without probes are always healthy. Unchanged states carry over to the
+// HealthChecks of a config reload, so requests still on the previous runtime see live probes.
+type HealthChecks struct {
+	states map[string]*healthState
+}
+
+type healthState struct {
+	lock      sync.RWMutex
+	started   sync.Once
+	done      chan struct{}
+	resource  string
+	url       URL
+	check     HealthCheck
+	healthy   bool
+	successes int
+	failures  int
+	since     time.Time
+}
+
+// UpstreamHealth is the current state of one probed upstream, exposed on /about.
+type UpstreamHealth struct {
+	Resource string
+	URL      string
+	Healthy  bool
+	Since    time.Time
+}
+
+const upHealthy = "upHealthy"
+const upHealthCheckStarted = "upstream health check started for resource %s, interval %v"
+const upHealthCheckNowHealthy = "upstream resource %s now healthy after %d successful probes"
+const upHealthCheckNowUnhealthy = "upstream resource %s now unhealthy after %d failed probes, cause: %s"
+const upHealthCheckUnexpectedStatus = "unexpected status code"
+
+// NewHealthChecks creates a probe state for each resource mapping with a healthCheck. Upstreams start healthy.
+func NewHealthChecks(resources map[string][]ResourceMapping) *HealthChecks {
+	hcs := &HealthChecks{states: make(map[string]*healthState)}
+	for name, mappings := range resources {
+		for _, mapping := range mappings {
+			if mapping.HealthCheck == nil {
+				continue
+			}
+			if _, ok := hcs.states[mapping.URL.String()]; ok {
+				continue
+			}
+			hcs.states[mapping.URL.String()] = &healthState{
+				resource: name,
+				url:      mapping.URL,
+				check:    *mapping.HealthCheck,
+				healthy:  true,
+				since:    time.Now(),
+				done:     make(chan struct{}),
+			}
+		}
+	}
+	return hcs
+}
+
+func (runtime *Runtime) initHealthChecks() *Runtime {
+	runtime.HealthChecks = NewHealthChecks(runtime.Resources)
+	runtime.HealthChecks.start()
+	return runtime
+}
+
+// start probes all upstreams that are not probed yet. States carried over from a previous runtime keep running.
+func (hcs *HealthChecks) start() {
+	for _, state := range hcs.states {
+		state := state
+		state.started.Do(func() {
+			go hcs.watch(state)
+		})
+	}
+}
+
+// retire ends the probes that the HealthChecks of the next runtime did not carry over.
+func (hcs *HealthChecks) retire(next *HealthChecks) {
+	if hcs == nil {
+		return
+	}
+	for key, state := range hcs.states {
+		if next == nil || next.states[key] != state {
+			close(state.done)
+		}
+	}
+}
+
+// carryOver adopts the probe state of upstreams with unchanged healthChecks after a config reload. Upstreams with
+// changed healthChecks get new probes that start with their previous health.
+func (hcs *HealthChecks) carryOver(previous *HealthChecks) *HealthChecks {
+	if previous == nil {
+		return hcs
+	}
+	for key, state := range hcs.states {
+		old, ok := previous.states[key]
+		if !ok {
+			continue
+		}
+		if old.resource == state.resource && reflect.DeepEqual(old.check, state.check) {
+			hcs.states[key] = old
+			continue
+		}
+		old.lock.RLock()
+		state.healthy = old.healthy
+		state.successes = old.successes
+		state.failures = old.failures
+		state.since = old.since
+		old.lock.RUnlock()
+	}
+	return hcs
+}
+
+func (hcs *HealthChecks) watch(state *healthState) {
+	log.Info().
+		Str(upResource, state.url.String()).
+		Msgf(upHealthCheckStarted, state.resource, state.check.intervalDuration())
+	for {
+		hcs.probe(state)
+		select {
+		case <-state.done:
+			return
+		case <-time.After(state.check.intervalDuration()):
+		}
+	}
+}
+
+func (hcs *HealthChecks) probe(state *healthState) {
+	ctx, cancel := context.WithTimeout(context.Background(), state.check.timeoutDuration())
+	defer cancel()
+
+	cause := emptyString
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, state.url.String()+state.check.Path, nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = httpClient.Do(req)
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if !state.check.expects(resp.StatusCode) {
+				cause = upHealthCheckUnexpectedStatus + " " + http.StatusText(resp.StatusCode)
+			}
+		}
+	}
+	if err != nil {
+		cause = err.Error()
+	}
+	hcs.update(state, len(cause) == 0, cause)
+}
+
+func (hcs *HealthChecks) update(state *healthState, ok bool, cause string) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if ok {
+		state.failures = 0
+		state.successes++
+		if !state.healthy && state.successes >= state.check.HealthyThreshold {
+			state.healthy = true
+			state.since = time.Now()
+			log.Info().
+				Str(upResource, state.url.String()).
+				Bool(upHealthy, true).
+				Msgf(upHealthCheckNowHealthy, state.resource, state.successes)
+		}
+	} else {
+		state.successes = 0
+		state.failures++
+		if state.healthy && state.failures >= state.check.UnhealthyThreshold {
+			state.healthy = false
+			state.since = time.Now()
+			log.Warn().
+				Str(upResource, state.url.String()).
+				Bool(upHealthy, false).
+				Msgf(upHealthCheckNowUnhealthy, state.resource, state.failures, cause)
+		}
+	}
+}
+
+// isHealthy tells if the upstream URL may receive traffic. Safe to call before health checks are initialised.
+func (hcs *HealthChecks) isHealthy(u URL) bool {
+	if hcs == nil {
+		return true
+	}
+	if state, ok := hcs.states[u.String()]; ok {
+		state.lock.RLock()
+		defer state.lock.RUnlock()
+		return state.healthy
+	}
+	return true
+}
+
+func (hcs *HealthChecks) report() []UpstreamHealth {
+	if hcs == nil {
+		return nil
+	}
+	report := make([]UpstreamHealth, 0, len(hcs.states))
+	for _, state := range hcs.states {
+		state.lock.RLock()
+		report = append(report, UpstreamHealth{
+			Resource: state.resource,
+			URL:      state.url.String(),
+			Healthy:  state.healthy,
+			Since:    state.since,
+		})
+		state.lock.RUnlock()
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Resource == report[j].Resource {
+			return report[i].URL < report[j].URL
+		}
+		return report[i].Resource < report[j].Resource
+	})
+	return report
+}
@@ -0,0 +1,110 @@
+package j8a
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func mockHealthCheckedResource(t *testing.T, statusCode *atomic.Int32) (*httptest.Server, URL) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("health check path want /health, got %s", r.URL.Path)
+		}
+		w.WriteHeader(int(statusCode.Load()))
+	}))
+	u, _ := url.Parse(server.URL)
+	return server, URL{Scheme: u.Scheme, Host: u.Hostname(), Port: u.Port()}
+}
+
+func TestHealthCheckTransitions(t *testing.T) {
+	Runner = mockRuntime()
+	httpClient = scaffoldHTTPClient(Runner)
+
+	var statusCode atomic.Int32
+	statusCode.Store(200)
+	server, u := mockHealthCheckedResource(t, &statusCode)
+	defer server.Close()
+
+	hcs := NewHealthChecks(map[string][]ResourceMapping{
+		"r1": {{Name: "r1", URL: u, HealthCheck: &HealthCheck{
+			Path:               "/health",
+			IntervalSeconds:    1,
+			TimeoutSeconds:     1,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		}}},
+	})
+	state := hcs.states[u.String()]
+
+	hcs.probe(state)
+	if !hcs.isHealthy(u) {
+		t.Error("upstream should start healthy")
+	}
+
+	statusCode.Store(503)
+	hcs.probe(state)
+	if !hcs.isHealthy(u) {
+		t.Error("upstream should stay healthy below unhealthy threshold")
+	}
+	hcs.probe(state)
+	if hcs.isHealthy(u) {
+		t.Error("upstream should be unhealthy after reaching unhealthy threshold")
+	}
+
+	statusCode.Store(200)
+	hcs.probe(state)
+	if hcs.isHealthy(u) {
+		t.Error("upstream should stay unhealthy below healthy threshold")
+	}
+	hcs.probe(state)
+	if !hcs.isHealthy(u) {
+		t.Error("upstream should be healthy after reaching healthy threshold")
+	}
+}
+
+func TestHealthCheckExpectedStatusCodes(t *testing.T) {
+	hc := HealthCheck{}
+	if !hc.expects(204) || hc.expects(301) {
+		t.Error("health check without statusCodes should expect any 2xx")
+	}
+	hc.StatusCodes = []int{200, 301}
+	if !hc.expects(301) || hc.expects(204) {
+		t.Error("health check should only expect configured statusCodes")
+	}
+}
+
+func TestHealthChecksNilIsHealthy(t *testing.T) {
+	var hcs *HealthChecks
+	if !hcs.isHealthy(URL{Scheme: "http", Host: "localhost", Port: "80"}) {
+		t.Error("upstreams should be healthy without health checks")
+	}
+	if hcs.report() != nil {
+		t.Error("report should be empty without health checks")
+	}
+}
+
+func TestMapURLSkipsUnhealthyResourceMapping(t *testing.T) {
+	Runner = mockRuntime()
+	down := URL{Scheme: "http", Host: "localhost", Port: "60001"}
+	up := URL{Scheme: "http", Host: "localhost", Port: "60002"}
+	Runner.Resources["r1"] = []ResourceMapping{
+		{Name: "r1", URL: down, HealthCheck: &HealthCheck{UnhealthyThreshold: 1}},
+		{Name: "r1", URL: up},
+	}
+	Runner.HealthChecks = NewHealthChecks(Runner.Resources)
+	Runner.HealthChecks.update(Runner.HealthChecks.states[down.String()], false, "down")
+
+	proxy := Proxy{}
+	got, _, mapped := Route{Path: "/", Resource: "r1"}.mapURL(&proxy)
+	if !mapped || *got != up {
+		t.Errorf("unhealthy resource mapping should be skipped, want %v, got %v", up, got)
+	}
+
+	Runner.HealthChecks.states[up.String()] = &healthState{url: up, healthy: false}
+	if _, _, mapped = (Route{Path: "/", Resource: "r1"}).mapURL(&proxy); mapped {
+		t.Error("route should not map when all resource mappings are unhealthy")
+	}
+}
@@ -1,11 +1,13 @@
 package j8a
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -16,35 +18,34 @@ type HTTPClient interface {
 	Get(uri string) (*http.Response, error)
 }
 
+// upstreamSocketTimeoutKey is the upstream request context key for a route socket timeout override.
+type upstreamSocketTimeoutKey struct{}
+
+// routeHTTPClients are the user agents for routes that override the upstream idleTimeout, keyed by that
+// idleTimeout, so their idle connections are kept in a separate pool.
+var routeHTTPClients sync.Map
+
+// dialContext dials with the socket timeout of the upstream request context if present.
+func dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(upstreamSocketTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+			d := *dialer
+			d.Timeout = timeout
+			return d.DialContext(ctx, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
 // scaffoldHTTPClient is a factory method that applies connection params to the transport layer of http.Client
 func scaffoldHTTPClient(runtime *Runtime) HTTPClient {
-	idleConnTimeoutDuration := time.Duration(runtime.Connection.Upstream.IdleTimeoutSeconds) * time.Second
-	tLSHandshakeTimeoutDuration := time.Duration(runtime.Connection.Upstream.SocketTimeoutSeconds) * time.Second
-	socketTimeoutDuration := time.Duration(runtime.Connection.Upstream.SocketTimeoutSeconds) * time.Second
-	readTimeoutDuration := time.Duration(runtime.Connection.Upstream.ReadTimeoutSeconds) * time.Second
+	idleConnTimeoutDuration := runtime.Connection.Upstream.idleTimeoutDuration()
+	tLSHandshakeTimeoutDuration := runtime.Connection.Upstream.socketTimeoutDuration()
+	socketTimeoutDuration := runtime.Connection.Upstream.socketTimeoutDuration()
+	readTimeoutDuration := runtime.Connection.Upstream.readTimeoutDuration()
 	tlsInsecureSkipVerify := runtime.Connection.Upstream.TlsInsecureSkipVerify
 
-	httpClient = &http.Client{
-		Transport: &http.Transport{
-			DisableCompression: true,
-			DialContext: (&net.Dialer{
-				Timeout:   socketTimeoutDuration,
-				KeepAlive: getKeepAliveIntervalDuration(),
-			}).DialContext,
-			//TLS handshake timeout is the same as connection timeout
-			TLSHandshakeTimeout: tLSHandshakeTimeoutDuration,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: tlsInsecureSkipVerify,
-			},
-			MaxIdleConns:        runtime.Connection.Upstream.PoolSize,
-			MaxIdleConnsPerHost: runtime.Connection.Upstream.PoolSize,
-			IdleConnTimeout:     idleConnTimeoutDuration,
-		},
-		//Timeout: readTimeoutDuration, don't use this anymore, proxyHandler now has it built-in
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+	httpClient = newHTTPClient(runtime.Connection.Upstream)
 
 	log.Info().
 		Int("upMaxIdleConns", runtime.Connection.Upstream.PoolSize).
@@ -53,24 +54,56 @@ func scaffoldHTTPClient(runtime *Runtime) HTTPClient {
 		Float64("upTlsHandshakeTimeoutSecs", tLSHandshakeTimeoutDuration.Seconds()).
 		Float64("upIdleConnTimeoutSecs", idleConnTimeoutDuration.Seconds()).
 		Float64("upReadTimeoutSecs", readTimeoutDuration.Seconds()).
-		Float64("upTransportDialKeepAliveIntervalSecs", getKeepAliveIntervalDuration().Seconds()).
+		Float64("upTransportDialKeepAliveIntervalSecs", getKeepAliveIntervalDuration(runtime.Connection.Upstream).Seconds()).
 		Bool("upTlsInsecureSkipVerify", tlsInsecureSkipVerify).
 		Msg("server derived upstream params")
 
 	return httpClient
 }
 
+func newHTTPClient(upstream Upstream) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DisableCompression: true,
+			DialContext: dialContext(&net.Dialer{
+				Timeout:   upstream.socketTimeoutDuration(),
+				KeepAlive: getKeepAliveIntervalDuration(upstream),
+			}),
+			//TLS handshake timeout is the same as connection timeout
+			TLSHandshakeTimeout: upstream.socketTimeoutDuration(),
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: upstream.TlsInsecureSkipVerify,
+			},
+			MaxIdleConns:        upstream.PoolSize,
+			MaxIdleConnsPerHost: upstream.PoolSize,
+			IdleConnTimeout:     upstream.idleTimeoutDuration(),
+		},
+		//Timeout: readTimeoutDuration, don't use this anymore, proxyHandler now has it built-in
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// routeHTTPClient is the user agent for connection upstream params with a different idleTimeout. Clients are
+// created once per idleTimeout.
+func routeHTTPClient(upstream Upstream, idleTimeout time.Duration) HTTPClient {
+	if client, ok := routeHTTPClients.Load(idleTimeout); ok {
+		return client.(HTTPClient)
+	}
+	upstream.IdleTimeout = Duration(idleTimeout)
+	client, _ := routeHTTPClients.LoadOrStore(idleTimeout, newHTTPClient(upstream))
+	return client.(HTTPClient)
+}
+
 // getKeepAliveIntervalSecondsDuration. KeepAlive is effectively: initial delay + interval * TCP_KEEPCNT (9 on linux, 8 ox OSX).
 // The KeepAliveIntervalSecondsDuration here defines interval, i.e. default 15s * 9 = 135s on linux
 // See: https://github.com/golang/go/issues/23459#issuecomment-374777402
 // The OS uses zero payload TCP segments to attempt to keep the connection alive.
 // after the total number of unacknowledged TCP_KEEPCNT is reached, the dialer kills the
 // connection.
-func getKeepAliveIntervalDuration() time.Duration {
-	return time.Duration(float64(Runner.
-		Connection.
-		Upstream.
-		IdleTimeoutSeconds) / float64(getTCPKeepCnt()) * float64(time.Second))
+func getKeepAliveIntervalDuration(upstream Upstream) time.Duration {
+	return time.Duration(float64(upstream.idleTimeoutDuration()) / float64(getTCPKeepCnt()))
 }
 
 func getTCPKeepCnt() int {
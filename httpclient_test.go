@@ -22,7 +22,7 @@ func TestHttpClientSocketTimeout(t *testing.T) {
 			},
 		},
 		Start:             time.Now(),
-		ConnectionWatcher: ConnectionWatcher{dwnOpenConns: 0},
+		ConnectionWatcher: &ConnectionWatcher{dwnOpenConns: 0},
 	}
 	Runner.initReloadableCert()
 
@@ -59,7 +59,7 @@ func TestGetTcpCntAndKeepAliveIntervalDuration(t *testing.T) {
 	if got != want {
 		t.Errorf("incorrect linux tcp cnt interval for socket timeout test, got %v, want %v", got, want)
 	}
-	gotKeepAlive := getKeepAliveIntervalDuration().Nanoseconds()
+	gotKeepAlive := getKeepAliveIntervalDuration(Runner.Connection.Upstream).Nanoseconds()
 	//nanos for keepAlive interval
 	wantKeepAlive := int64(120 / float64(got) * 1000000000)
 	if gotKeepAlive != wantKeepAlive {
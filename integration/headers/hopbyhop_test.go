@@ -0,0 +1,58 @@
+package headers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHopByHopHeadersNotSentUpstream(t *testing.T) {
+	client := &http.Client{}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/mse6/echoheader", nil)
+	req.Header.Add("Connection", "X-Hop")
+	req.Header.Add("X-Hop", "secret")
+	req.Header.Add("Keep-Alive", "timeout=5")
+	req.Header.Add("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	req.Header.Add("X-End", "kept")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("error connecting to server, cause: %s", err)
+	}
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	utf8 := string(body)
+	for _, hop := range []string{"X-Hop", "Keep-Alive", "Proxy-Authorization"} {
+		if strings.Contains(utf8, hop+":") {
+			t.Errorf("should not have sent hop-by-hop header %s upstream, but sent this %s", hop, body)
+		}
+	}
+	if !strings.Contains(utf8, "X-End:[kept]") {
+		t.Errorf("should have sent end-to-end header upstream, but sent this %s", body)
+	}
+	if !strings.Contains(utf8, "Via:[1.1 j8a]") {
+		t.Errorf("should have sent Via header upstream, but sent this %s", body)
+	}
+}
+
+func TestViaHeaderSentDownstream(t *testing.T) {
+	client := &http.Client{}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/mse6/get", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("error connecting to server, cause: %s", err)
+	}
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	if got := resp.Header.Get("Via"); !strings.HasSuffix(got, "j8a") {
+		t.Errorf("should have sent Via header downstream, got %s", got)
+	}
+	if len(resp.Header.Get("Keep-Alive")) > 0 || len(resp.Header.Get("Proxy-Authenticate")) > 0 {
+		t.Errorf("should not have sent hop-by-hop headers downstream, got %v", resp.Header)
+	}
+}
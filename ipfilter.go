@@ -0,0 +1,192 @@
+package j8a
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IPFilter allows or denies downstream requests by client IP.
+type IPFilter struct {
+	// Allow lists the CIDRs or IPs, v4 or v6, that may send requests. All other clients are denied if set
+	Allow []string
+
+	// Deny lists the CIDRs or IPs that are denied. Takes precedence over Allow
+	Deny []string
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+const clientIPForbidden = "client IP forbidden"
+const clientIPDenied = "downstream request denied for client IP %v"
+const forwarded = "Forwarded"
+const xForwardedFor = "X-Forwarded-For"
+
+// parseCIDRs parses CIDRs and single IPs, which become /32 or /128 networks.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %s", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %s", c)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *IPFilter) compile() error {
+	var err error
+	if f.allow, err = parseCIDRs(f.Allow); err != nil {
+		return err
+	}
+	f.deny, err = parseCIDRs(f.Deny)
+	return err
+}
+
+// allows tells if the client IP passes the filter. Unknown client IPs only pass filters without rules.
+func (f *IPFilter) allows(ip net.IP) bool {
+	if f == nil || (len(f.allow) == 0 && len(f.deny) == 0) {
+		return true
+	}
+	if ip == nil || containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+func (config Config) validateIPFilters() *Config {
+	dwn := &config.Connection.Downstream
+	var err error
+	if dwn.trustedProxies, err = parseCIDRs(dwn.TrustedProxies); err != nil {
+		config.panic(fmt.Sprintf("connection downstream trustedProxies %v", err))
+	}
+	if dwn.IPFilter != nil {
+		if err := dwn.IPFilter.compile(); err != nil {
+			config.panic(fmt.Sprintf("connection downstream ipFilter %v", err))
+		}
+	}
+	for _, route := range config.Routes {
+		if route.IPFilter != nil {
+			if err := route.IPFilter.compile(); err != nil {
+				config.panic(fmt.Sprintf("route %s ipFilter %v", route.Path, err))
+			}
+		}
+	}
+	return &config
+}
+
+// clientIP is the downstream remote address. If that is a trusted proxy, it is the last address in the Forwarded
+// or X-Forwarded-For header that is not a trusted proxy itself.
+func (proxy *Proxy) clientIP() net.IP {
+	ip := proxy.remoteIP()
+	if !proxy.isTrustedProxy(ip) {
+		return ip
+	}
+	trusted := proxy.runtime().Connection.Downstream.trustedProxies
+	hops := forwardedFor(proxy.Dwn.Req)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseForwardedNode(hops[i])
+		if hop == nil {
+			//obfuscated or malformed, the last trusted proxy is all we know
+			return ip
+		}
+		ip = hop
+		if !containsIP(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP is the address of the downstream peer, which may be a proxy.
+func (proxy *Proxy) remoteIP() net.IP {
+	host, _, err := net.SplitHostPort(proxy.Dwn.Req.RemoteAddr)
+	if err != nil {
+		host = proxy.Dwn.Req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func (proxy *Proxy) isTrustedProxy(ip net.IP) bool {
+	return ip != nil && containsIP(proxy.runtime().Connection.Downstream.trustedProxies, ip)
+}
+
+// forwardedFor lists the for= nodes of the RFC7239 Forwarded header, or X-Forwarded-For if there is none.
+func forwardedFor(req *http.Request) []string {
+	var hops []string
+	if values := req.Header.Values(forwarded); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && strings.EqualFold(k, "for") {
+					hops = append(hops, v)
+				}
+			}
+		}
+		return hops
+	}
+	for _, v := range req.Header.Values(xForwardedFor) {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	return hops
+}
+
+// parseForwardedNode parses node values like 192.0.2.43, "192.0.2.43:47011" or "[2001:db8:cafe::17]:4711".
+func parseForwardedNode(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), "\"")
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			node = node[1:end]
+		}
+	} else if strings.Count(node, ":") == 1 {
+		node, _, _ = strings.Cut(node, ":")
+	}
+	return net.ParseIP(node)
+}
+
+// isClientAllowed applies the global and route IP filters to the client IP.
+func (proxy *Proxy) isClientAllowed() bool {
+	global := proxy.runtime().Connection.Downstream.IPFilter
+	var route *IPFilter
+	if proxy.Route != nil {
+		route = proxy.Route.IPFilter
+	}
+	if global == nil && route == nil {
+		return true
+	}
+
+	ip := proxy.clientIP()
+	if global.allows(ip) && route.allows(ip) {
+		return true
+	}
+	infoOrTraceEv(proxy).
+		Str(XRequestID, proxy.XRequestID).
+		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+		Msgf(clientIPDenied, ip)
+	return false
+}
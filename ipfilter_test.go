@@ -0,0 +1,123 @@
+package j8a
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilterAllows(t *testing.T) {
+	f := &IPFilter{Allow: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"}, Deny: []string{"10.1.0.0/16"}}
+	if err := f.compile(); err != nil {
+		t.Fatalf("filter should compile, got %v", err)
+	}
+
+	var tests = []struct {
+		ip   string
+		want bool
+	}{
+		{"10.2.3.4", true},
+		{"10.1.3.4", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.2.3.4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := f.allows(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("want allows %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if f.allows(nil) {
+		t.Errorf("unknown client IP should not pass filter with rules")
+	}
+	var none *IPFilter
+	if !none.allows(nil) {
+		t.Errorf("nil filter should allow")
+	}
+	deny := &IPFilter{Deny: []string{"10.0.0.0/8"}}
+	deny.compile()
+	if !deny.allows(net.ParseIP("11.0.0.1")) {
+		t.Errorf("deny only filter should allow others")
+	}
+}
+
+func TestValidateIPFiltersFails(t *testing.T) {
+	var tests = []struct {
+		n string
+		c Config
+	}{
+		{"bad route allow", Config{Routes: Routes{{Path: "/", IPFilter: &IPFilter{Allow: []string{"10.0.0.0/33"}}}}}},
+		{"bad global deny", Config{Connection: Connection{Downstream: Downstream{IPFilter: &IPFilter{Deny: []string{"localhost"}}}}}},
+		{"bad trusted proxy", Config{Connection: Connection{Downstream: Downstream{TrustedProxies: []string{"10.0.0"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			tt.c.validateIPFilters()
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.TrustedProxies = []string{"10.0.0.0/8", "2001:db8::/32"}
+	Runner.Config = *Runner.Config.validateIPFilters()
+
+	var tests = []struct {
+		n      string
+		remote string
+		header string
+		value  string
+		want   string
+	}{
+		{"untrusted peer ignores header", "1.1.1.1:1000", xForwardedFor, "2.2.2.2", "1.1.1.1"},
+		{"trusted peer uses header", "10.0.0.1:1000", xForwardedFor, "2.2.2.2", "2.2.2.2"},
+		{"skips trusted hops", "10.0.0.1:1000", xForwardedFor, "3.3.3.3, 2.2.2.2, 10.0.0.2", "2.2.2.2"},
+		{"all hops trusted", "10.0.0.1:1000", xForwardedFor, "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"no header", "10.0.0.1:1000", "", "", "10.0.0.1"},
+		{"forwarded", "10.0.0.1:1000", forwarded, `for=2.2.2.2;proto=https, for="10.0.0.2:8080"`, "2.2.2.2"},
+		{"forwarded ipv6", "[2001:db8::1]:1000", forwarded, `for="[2001:db9::17]:4711"`, "2001:db9::17"},
+		{"forwarded obfuscated", "10.0.0.1:1000", forwarded, "for=_hidden", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if len(tt.header) > 0 {
+				req.Header.Set(tt.header, tt.value)
+			}
+			proxy := Proxy{Dwn: Down{Req: req}}
+			if got := proxy.clientIP().String(); got != tt.want {
+				t.Errorf("want client IP %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerIPFilterForbidden(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].IPFilter = &IPFilter{Allow: []string{"10.0.0.0/8"}}
+	Runner.Config = *Runner.Config.validateIPFilters()
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Errorf("client outside allow list should be forbidden, got %d", resp.StatusCode)
+	}
+}
@@ -493,6 +493,11 @@ func (jwt *Jwt) checkECDSABitSize(alg jwa.SignatureAlgorithm, parsed *ecdsa.Publ
 	return err
 }
 
+// hasKeys tells if at least one key was parsed from config or loaded from the jwks URL.
+func (jwt *Jwt) hasKeys() bool {
+	return len(jwt.RSAPublic)+len(jwt.ECDSAPublic)+len(jwt.Secret) > 0
+}
+
 func (jwt *Jwt) hasMandatoryClaims() bool {
 	return len(jwt.Claims) > 0 && len(jwt.Claims[0]) > 0
 }
@@ -0,0 +1,191 @@
+package j8a
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+const roundRobin = "roundRobin"
+const leastOutstanding = "leastOutstanding"
+const random = "random"
+const consistentHash = "consistentHash"
+const weighted = "weighted"
+
+const hashOnHeader = "header"
+const hashOnCookie = "cookie"
+const hashOnClientIP = "clientIP"
+
+// LoadBalancing describes how traffic is shared between the resource mappings of one resource.
+type LoadBalancing struct {
+	// Strategy is one of roundRobin | leastOutstanding | random | consistentHash | weighted, defaults to roundRobin
+	Strategy string
+
+	// HashOn is the source of the consistentHash key, one of header | cookie | clientIP
+	HashOn string
+
+	// HashKey is the name of the header or cookie used by consistentHash
+	HashKey string
+
+	balancer LoadBalancer
+}
+
+// LoadBalancer chooses the resource mapping for an upstream attempt. candidates are healthy, never empty
+// and in config order.
+type LoadBalancer interface {
+	choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping
+}
+
+// NewLoadBalancer creates the LoadBalancer for a validated LoadBalancing strategy.
+func NewLoadBalancer(lb LoadBalancing) LoadBalancer {
+	switch lb.Strategy {
+	case leastOutstanding:
+		return leastOutstandingBalancer{}
+	case random:
+		return randomBalancer{}
+	case consistentHash:
+		return consistentHashBalancer{hashOn: lb.HashOn, hashKey: lb.HashKey}
+	case weighted:
+		return weightedBalancer{}
+	default:
+		return &roundRobinBalancer{}
+	}
+}
+
+// loadBalance chooses among candidates of a resource with its configured strategy. Resources without one
+// use the first candidate.
+func (runtime *Runtime) loadBalance(resource string, candidates []*ResourceMapping, proxy *Proxy) (string, *ResourceMapping) {
+	if lb, ok := runtime.LoadBalancing[resource]; ok && lb.balancer != nil {
+		return lb.Strategy, lb.balancer.choose(candidates, proxy)
+	}
+	return defaultMsg, candidates[0]
+}
+
+// untriedResourceMappings filters candidates whose URL was not used by any upstream attempt yet.
+func (proxy *Proxy) untriedResourceMappings(candidates []*ResourceMapping) []*ResourceMapping {
+	var untried []*ResourceMapping
+Candidates:
+	for _, c := range candidates {
+		for _, atmpt := range proxy.Up.Atmpts {
+			if atmpt.URL != nil && *atmpt.URL == c.URL {
+				continue Candidates
+			}
+		}
+		untried = append(untried, c)
+	}
+	return untried
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (rr *roundRobinBalancer) choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping {
+	n := rr.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+type randomBalancer struct{}
+
+func (randomBalancer) choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping {
+	return candidates[rand.Intn(len(candidates))]
+}
+
+type leastOutstandingBalancer struct{}
+
+func (leastOutstandingBalancer) choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping {
+	least := candidates[0]
+	min := outstandingRequests.count(least.URL)
+	for _, c := range candidates[1:] {
+		if n := outstandingRequests.count(c.URL); n < min {
+			least, min = c, n
+		}
+	}
+	return least
+}
+
+// consistentHashBalancer uses rendezvous hashing so that only keys of a removed upstream move elsewhere.
+type consistentHashBalancer struct {
+	hashOn  string
+	hashKey string
+}
+
+func (ch consistentHashBalancer) choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping {
+	key := ch.key(proxy)
+	if len(key) == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	var best *ResourceMapping
+	var bestScore uint64
+	for _, c := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(c.URL.String()))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+func (ch consistentHashBalancer) key(proxy *Proxy) string {
+	req := proxy.Dwn.Req
+	if req == nil {
+		return emptyString
+	}
+	switch ch.hashOn {
+	case hashOnHeader:
+		return req.Header.Get(ch.hashKey)
+	case hashOnCookie:
+		if c, err := req.Cookie(ch.hashKey); err == nil {
+			return c.Value
+		}
+	case hashOnClientIP:
+		return ipr.extractAddr(req.RemoteAddr)
+	}
+	return emptyString
+}
+
+type weightedBalancer struct{}
+
+func (weightedBalancer) choose(candidates []*ResourceMapping, proxy *Proxy) *ResourceMapping {
+	var total float64
+	for _, c := range candidates {
+		total += c.weight()
+	}
+	dice := rand.Float64() * total
+	for _, c := range candidates {
+		if dice < c.weight() {
+			return c
+		}
+		dice -= c.weight()
+	}
+	return candidates[len(candidates)-1]
+}
+
+// outstandingRequests counts upstream attempts in flight per URL.String() for leastOutstanding.
+var outstandingRequests = upstreamCounters{}
+
+type upstreamCounters struct {
+	counts sync.Map
+}
+
+func (uc *upstreamCounters) counter(u URL) *atomic.Int64 {
+	c, _ := uc.counts.LoadOrStore(u.String(), new(atomic.Int64))
+	return c.(*atomic.Int64)
+}
+
+func (uc *upstreamCounters) count(u URL) int64 {
+	return uc.counter(u).Load()
+}
+
+// begin marks an upstream attempt in flight and returns the func that ends it.
+func (uc *upstreamCounters) begin(u URL) func() {
+	c := uc.counter(u)
+	c.Add(1)
+	return func() {
+		c.Add(-1)
+	}
+}
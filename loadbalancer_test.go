@@ -0,0 +1,170 @@
+package j8a
+
+import (
+	"net/http"
+	"testing"
+)
+
+func mockCandidates(ports ...string) []*ResourceMapping {
+	var candidates []*ResourceMapping
+	for _, p := range ports {
+		candidates = append(candidates, &ResourceMapping{URL: URL{Scheme: "http", Host: "localhost", Port: p}})
+	}
+	return candidates
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	lb := NewLoadBalancer(LoadBalancing{Strategy: roundRobin})
+	candidates := mockCandidates("1", "2", "3")
+	for i := 0; i < 6; i++ {
+		got := lb.choose(candidates, &Proxy{})
+		if got != candidates[i%3] {
+			t.Errorf("round robin choice %d want %v, got %v", i, candidates[i%3].URL, got.URL)
+		}
+	}
+}
+
+func TestLeastOutstandingBalancer(t *testing.T) {
+	lb := NewLoadBalancer(LoadBalancing{Strategy: leastOutstanding})
+	candidates := mockCandidates("61001", "61002")
+
+	release := outstandingRequests.begin(candidates[0].URL)
+	if got := lb.choose(candidates, &Proxy{}); got != candidates[1] {
+		t.Errorf("least outstanding want %v, got %v", candidates[1].URL, got.URL)
+	}
+	release()
+	if got := lb.choose(candidates, &Proxy{}); got != candidates[0] {
+		t.Errorf("least outstanding want %v, got %v", candidates[0].URL, got.URL)
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	var tests = []struct {
+		n  string
+		lb LoadBalancing
+		r  func(*http.Request)
+	}{
+		{"header", LoadBalancing{Strategy: consistentHash, HashOn: hashOnHeader, HashKey: "X-User"},
+			func(r *http.Request) { r.Header.Set("X-User", "ben") }},
+		{"cookie", LoadBalancing{Strategy: consistentHash, HashOn: hashOnCookie, HashKey: "session"},
+			func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "abc"}) }},
+		{"clientIP", LoadBalancing{Strategy: consistentHash, HashOn: hashOnClientIP},
+			func(r *http.Request) { r.RemoteAddr = "10.1.1.1:4567" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			lb := NewLoadBalancer(tt.lb)
+			candidates := mockCandidates("1", "2", "3", "4")
+			req, _ := http.NewRequest("GET", "/", nil)
+			tt.r(req)
+			proxy := &Proxy{}
+			proxy.Dwn.Req = req
+
+			first := lb.choose(candidates, proxy)
+			for i := 0; i < 10; i++ {
+				if got := lb.choose(candidates, proxy); got != first {
+					t.Errorf("consistent hash should be sticky, want %v, got %v", first.URL, got.URL)
+				}
+			}
+
+			//removing another upstream must not move the key
+			var rest []*ResourceMapping
+			for _, c := range candidates {
+				if c != first {
+					rest = append(rest, c)
+				}
+			}
+			if got := lb.choose(append(rest[1:], first), proxy); got != first {
+				t.Errorf("consistent hash should keep key on %v after removing %v, got %v", first.URL, rest[0].URL, got.URL)
+			}
+		})
+	}
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	lb := NewLoadBalancer(LoadBalancing{Strategy: weighted})
+	candidates := mockCandidates("1", "2")
+	light, heavy := 0.000001, 1000.0
+	candidates[0].Weight = &light
+	candidates[1].Weight = &heavy
+
+	counts := make(map[*ResourceMapping]int)
+	for i := 0; i < 1000; i++ {
+		counts[lb.choose(candidates, &Proxy{})]++
+	}
+	if counts[candidates[1]] < 990 {
+		t.Errorf("weighted should prefer heavy upstream, got %d/1000", counts[candidates[1]])
+	}
+}
+
+func TestRemapURLMovesRetryToNextBackend(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Resources["r1"] = []ResourceMapping{
+		{Name: "r1", URL: URL{Scheme: "http", Host: "localhost", Port: "61001"}},
+		{Name: "r1", URL: URL{Scheme: "http", Host: "localhost", Port: "61002"}},
+	}
+	Runner.Config = *Runner.Config.validateLoadBalancing()
+
+	route := Route{Path: "/", Resource: "r1"}
+	proxy := &Proxy{Route: &route}
+	url, label, _ := route.mapURL(proxy)
+	proxy.firstAttempt(url, label)
+
+	for i := 0; i < 3; i++ {
+		next, _, mapped := route.remapURL(proxy)
+		if !mapped || *next == *url {
+			t.Errorf("retry should move away from %v, got %v", url, next)
+		}
+	}
+}
+
+func TestZeroWeightMappingGetsNoTraffic(t *testing.T) {
+	Runner = mockRuntime()
+	drained := 0.0
+	Runner.Resources["r1"] = []ResourceMapping{
+		{Name: "r1", URL: URL{Scheme: "http", Host: "localhost", Port: "61001"}, Weight: &drained},
+		{Name: "r1", URL: URL{Scheme: "http", Host: "localhost", Port: "61002"}},
+	}
+	Runner.Config = *Runner.Config.validateLoadBalancing()
+
+	route := Route{Path: "/", Resource: "r1"}
+	for i := 0; i < 10; i++ {
+		url, _, mapped := route.mapURL(&Proxy{Route: &route})
+		if !mapped || url.Port != "61002" {
+			t.Errorf("mapping with weight 0 should get no traffic, got %v", url)
+		}
+	}
+
+	Runner.Resources["r1"] = Runner.Resources["r1"][:1]
+	if _, _, mapped := route.mapURL(&Proxy{Route: &route}); mapped {
+		t.Errorf("resource with only weight 0 mappings should not be mapped")
+	}
+}
+
+func TestValidateLoadBalancingFails(t *testing.T) {
+	var tests = []struct {
+		n  string
+		lb LoadBalancing
+	}{
+		{"unknown strategy", LoadBalancing{Strategy: "fastest"}},
+		{"consistentHash without hashOn", LoadBalancing{Strategy: consistentHash}},
+		{"consistentHash on header without hashKey", LoadBalancing{Strategy: consistentHash, HashOn: hashOnHeader}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked for %s", tt.n)
+				}
+			}()
+			lb := tt.lb
+			config := &Config{
+				Resources:     map[string][]ResourceMapping{"r1": {{URL: URL{Scheme: "http", Host: "localhost", Port: "8080"}}}},
+				LoadBalancing: map[string]*LoadBalancing{"r1": &lb},
+			}
+			config.validateLoadBalancing()
+		})
+	}
+}
@@ -43,7 +43,7 @@ func TestLogLevelReset(t *testing.T) {
 				LogLevel: tt.l,
 			}
 			initLogger()
-			c.validateLogLevel()
+			c = *c.validateLogLevel()
 
 			Runner = &Runtime{
 				Config:       c,
@@ -0,0 +1,303 @@
+package j8a
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Metrics params for the Prometheus endpoint on /metrics.
+type Metrics struct {
+	// Enabled serves /metrics on the downstream http and tls listeners. No route may match /metrics then. Defaults to false
+	Enabled bool
+
+	// Port serves /metrics on a separate HTTP listener instead of the downstream http and tls listeners. Off if 0
+	Port int
+}
+
+const metricsPath = "/metrics"
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+const metricsListenerInit = "j8a %s metrics listener init on HTTP:%d..."
+
+const counterType = "counter"
+const gaugeType = "gauge"
+const histogramType = "histogram"
+
+// latencyBuckets are upper bounds in seconds for request latency histograms.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metricFamily is one named metric with a fixed set of label names and one series per label values.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	lock    sync.Mutex
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	values  []string
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+func newMetricFamily(name string, kind string, help string, labels ...string) *metricFamily {
+	return &metricFamily{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*metricSeries),
+	}
+}
+
+func newHistogram(name string, help string, buckets []float64, labels ...string) *metricFamily {
+	mf := newMetricFamily(name, histogramType, help, labels...)
+	mf.buckets = buckets
+	return mf
+}
+
+func (mf *metricFamily) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := mf.series[key]
+	if !ok {
+		s = &metricSeries{values: values, counts: make([]uint64, len(mf.buckets))}
+		mf.series[key] = s
+	}
+	return s
+}
+
+// add changes a counter or gauge by v.
+func (mf *metricFamily) add(v float64, values ...string) {
+	mf.lock.Lock()
+	defer mf.lock.Unlock()
+	mf.get(values).value += v
+}
+
+// observe records v in a histogram.
+func (mf *metricFamily) observe(v float64, values ...string) {
+	mf.lock.Lock()
+	defer mf.lock.Unlock()
+	s := mf.get(values)
+	for i, le := range mf.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.samples++
+}
+
+// value returns the current counter or gauge value of a series, 0 if it does not exist.
+func (mf *metricFamily) value(values ...string) float64 {
+	mf.lock.Lock()
+	defer mf.lock.Unlock()
+	if s, ok := mf.series[strings.Join(values, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (mf *metricFamily) write(w io.Writer) {
+	mf.lock.Lock()
+	defer mf.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", mf.name, mf.help, mf.name, mf.kind)
+	keys := make([]string, 0, len(mf.series))
+	for k := range mf.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	leNames := append(append([]string{}, mf.labels...), "le")
+	for _, k := range keys {
+		s := mf.series[k]
+		if mf.kind != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", mf.name, formatLabels(mf.labels, s.values), formatMetricValue(s.value))
+			continue
+		}
+		leValues := append(append([]string{}, s.values...), emptyString)
+		for i, le := range mf.buckets {
+			leValues[len(leValues)-1] = formatMetricValue(le)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", mf.name, formatLabels(leNames, leValues), s.counts[i])
+		}
+		leValues[len(leValues)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", mf.name, formatLabels(leNames, leValues), s.samples)
+		fmt.Fprintf(w, "%s_sum%s %s\n", mf.name, formatLabels(mf.labels, s.values), formatMetricValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", mf.name, formatLabels(mf.labels, s.values), s.samples)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return emptyString
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelValueEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var metricRequests = newMetricFamily("j8a_http_requests_total", counterType,
+	"Downstream HTTP requests served.", "route", "resource", "label", "method", "status")
+var metricRequestDuration = newHistogram("j8a_http_request_duration_seconds",
+	"Downstream HTTP request latency in seconds.", latencyBuckets, "route", "resource", "label", "method", "status")
+var metricUpstreamAttempts = newMetricFamily("j8a_upstream_attempts_total", counterType,
+	"Upstream attempts by outcome.", "resource", "upstream", "outcome")
+var metricUpstreamRetries = newMetricFamily("j8a_upstream_retries_total", counterType,
+	"Upstream attempts that retried a previous attempt.", "route", "resource")
+var metricJwtRejects = newMetricFamily("j8a_jwt_rejects_total", counterType,
+	"Downstream requests rejected for a missing or invalid jwt.", "route")
+var metricRateLimited = newMetricFamily("j8a_rate_limited_total", counterType,
+	"Downstream requests rejected by a rate limit.", "route", "rate_limit")
+var metricWebsocketSessions = newMetricFamily("j8a_websocket_sessions", gaugeType,
+	"Open downstream websocket sessions.", "route", "resource")
+
+var metricFamilies = []*metricFamily{
+	metricRequests,
+	metricRequestDuration,
+	metricUpstreamAttempts,
+	metricUpstreamRetries,
+	metricJwtRejects,
+	metricRateLimited,
+	metricWebsocketSessions,
+}
+
+var outcomeNames = map[attemptOutcome]string{
+	attemptSuccess: "success",
+	attemptFailure: "failure",
+	attemptIgnored: "ignored",
+}
+
+// lastSample is the most recent process sample taken by the stats logger, nil before the first one.
+var lastSample atomic.Pointer[sample]
+
+func (proxy *Proxy) routeLabels() (string, string) {
+	if proxy.Route == nil {
+		return emptyString, emptyString
+	}
+	return proxy.Route.Path, proxy.Route.Resource
+}
+
+func (proxy *Proxy) observeDownstreamRoundtrip(elapsed time.Duration) {
+	route, resource := proxy.routeLabels()
+	label := emptyString
+	if proxy.hasMadeUpstreamAttempt() {
+		label = proxy.Up.Atmpt.Label
+	}
+	status := strconv.Itoa(proxy.Dwn.Resp.StatusCode)
+	metricRequests.add(1, route, resource, label, proxy.Dwn.Method, status)
+	metricRequestDuration.observe(elapsed.Seconds(), route, resource, label, proxy.Dwn.Method, status)
+}
+
+func (proxy *Proxy) observeUpstreamAttempt() {
+	if proxy.Up.Atmpt == nil || proxy.Up.Atmpt.URL == nil {
+		return
+	}
+	_, resource := proxy.routeLabels()
+	metricUpstreamAttempts.add(1, resource, proxy.Up.Atmpt.URL.String(), outcomeNames[proxy.attemptOutcome()])
+}
+
+func (proxy *Proxy) observeUpstreamRetry() {
+	route, resource := proxy.routeLabels()
+	metricUpstreamRetries.add(1, route, resource)
+}
+
+func (proxy *Proxy) observeJwtReject() {
+	route, _ := proxy.routeLabels()
+	metricJwtRejects.add(1, route)
+}
+
+func (proxy *Proxy) observeRateLimited() {
+	route, _ := proxy.routeLabels()
+	metricRateLimited.add(1, route, proxy.Route.RateLimit)
+}
+
+func (proxy *Proxy) observeWebsocketSession(delta float64) {
+	route, resource := proxy.routeLabels()
+	metricWebsocketSessions.add(delta, route, resource)
+}
+
+func writeGauge(w io.Writer, name string, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, gaugeType, name, formatMetricValue(v))
+}
+
+// writeRuntimeMetrics renders the process sample fields and live tcp connection counts.
+func (runtime *Runtime) writeRuntimeMetrics(w io.Writer) {
+	if s := lastSample.Load(); s != nil {
+		writeGauge(w, "j8a_process_cpu_core_percent", "CPU usage in percent of one core.", s.cpuPc)
+		writeGauge(w, "j8a_process_memory_percent", "Memory usage in percent of total memory.", float64(s.mPc))
+		writeGauge(w, "j8a_process_resident_memory_bytes", "Resident memory size in bytes.", float64(s.rssBytes))
+		writeGauge(w, "j8a_process_virtual_memory_bytes", "Virtual memory size in bytes.", float64(s.vmsBytes))
+		writeGauge(w, "j8a_process_swap_bytes", "Swapped memory in bytes.", float64(s.swapBytes))
+		writeGauge(w, "j8a_process_os_threads", "OS threads created.", float64(s.threads))
+		writeGauge(w, "j8a_process_open_files_limit", "Ulimit for open files.", float64(s.ulimit))
+	}
+	cw := runtime.ConnectionWatcher
+	writeGauge(w, "j8a_downstream_open_tcp_connections", "Open downstream tcp connections.", float64(cw.DwnCount()))
+	writeGauge(w, "j8a_downstream_max_open_tcp_connections", "Max open downstream tcp connections.", float64(cw.DwnMaxCount()))
+	writeGauge(w, "j8a_upstream_open_tcp_connections", "Open upstream tcp connections.", float64(cw.UpCount()))
+	writeGauge(w, "j8a_upstream_max_open_tcp_connections", "Max open upstream tcp connections.", float64(cw.UpMaxCount()))
+}
+
+// renderMetrics writes all metrics in Prometheus text exposition format.
+func (runtime *Runtime) renderMetrics() []byte {
+	var b bytes.Buffer
+	for _, mf := range metricFamilies {
+		mf.write(&b)
+	}
+	runtime.writeRuntimeMetrics(&b)
+	return b.Bytes()
+}
+
+func (runtime *Runtime) hasMetricsListener() bool {
+	return runtime.Connection.Downstream.Metrics.Port > 0
+}
+
+// hasDownstreamMetrics tells if /metrics is served on the downstream http and tls listeners.
+func (config Config) hasDownstreamMetrics() bool {
+	return config.Connection.Downstream.Metrics.Enabled && config.Connection.Downstream.Metrics.Port == 0
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	sendEncodedResponse(w, r, 200, "ok", metricsContentType, requestRuntime(r).renderMetrics)
+}
+
+// MetricsDelegate serves only /metrics on the separate metrics listener.
+type MetricsDelegate struct{}
+
+func (md MetricsDelegate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if metricsRex.MatchString(r.RequestURI) {
+		metricsHandler(w, r)
+	} else {
+		proxy := new(Proxy).
+			parseIncoming(r).
+			setOutgoing(w)
+		sendStatusCodeAsJSON(proxy.respondWith(404, upstreamResourceNotFound))
+	}
+}
+
+func (runtime *Runtime) startMetrics(server *http.Server, err chan<- error) {
+	log.Info().Msgf(metricsListenerInit, Version, runtime.Connection.Downstream.Metrics.Port)
+	err <- server.ListenAndServe()
+}
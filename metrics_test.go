@@ -0,0 +1,193 @@
+package j8a
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// this testHandler binds the mock HTTP server to metricsHandler.
+type MetricsHttpHandler struct{}
+
+func (t MetricsHttpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	metricsHandler(w, r)
+}
+
+func TestMetricFamilyCounterRendersLabels(t *testing.T) {
+	mf := newMetricFamily("test_total", counterType, "test counter.", "route", "status")
+	mf.add(1, "/a", "200")
+	mf.add(2, "/a", "200")
+	mf.add(1, "/b\"", "500")
+
+	var b bytes.Buffer
+	mf.write(&b)
+	got := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_total counter\n",
+		"test_total{route=\"/a\",status=\"200\"} 3\n",
+		"test_total{route=\"/b\\\"\",status=\"500\"} 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("counter output missing %q, got:\n%v", want, got)
+		}
+	}
+}
+
+func TestMetricFamilyHistogramCountsCumulativeBuckets(t *testing.T) {
+	mf := newHistogram("test_seconds", "test histogram.", []float64{0.1, 1}, "route")
+	mf.observe(0.05, "/")
+	mf.observe(0.5, "/")
+	mf.observe(5, "/")
+
+	var b bytes.Buffer
+	mf.write(&b)
+	got := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_seconds histogram\n",
+		"test_seconds_bucket{route=\"/\",le=\"0.1\"} 1\n",
+		"test_seconds_bucket{route=\"/\",le=\"1\"} 2\n",
+		"test_seconds_bucket{route=\"/\",le=\"+Inf\"} 3\n",
+		"test_seconds_sum{route=\"/\"} 5.55\n",
+		"test_seconds_count{route=\"/\"} 3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("histogram output missing %q, got:\n%v", want, got)
+		}
+	}
+}
+
+func TestObserveDownstreamRoundtripCountsRequest(t *testing.T) {
+	Runner = mockRuntime()
+	route := Route{Path: "/metricsobserve", Resource: "default"}
+	proxy := &Proxy{Route: &route}
+	proxy.Dwn.Method = "GET"
+	proxy.Dwn.Resp.StatusCode = 200
+
+	before := metricRequests.value("/metricsobserve", "default", "", "GET", "200")
+	proxy.observeDownstreamRoundtrip(time.Millisecond)
+	if got := metricRequests.value("/metricsobserve", "default", "", "GET", "200"); got != before+1 {
+		t.Errorf("request counter not incremented, want %v, got %v", before+1, got)
+	}
+}
+
+func TestMetricsHandlerServesTextExposition(t *testing.T) {
+	Runner = mockRuntime()
+	metricJwtRejects.add(1, "/metricshandler")
+
+	server := httptest.NewServer(&MetricsHttpHandler{})
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(acceptEncoding, "identity")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("want status 200, got %v", resp.StatusCode)
+	}
+	if got := resp.Header.Get(contentType); got != metricsContentType {
+		t.Errorf("want content type %v, got %v", metricsContentType, got)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	for _, want := range []string{
+		"j8a_jwt_rejects_total{route=\"/metricshandler\"}",
+		"# TYPE j8a_downstream_open_tcp_connections gauge",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics body missing %q", want)
+		}
+	}
+}
+
+func TestValidateMetricsPortSameAsHttpPortFails(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config did not panic for metrics port same as http port")
+		}
+	}()
+
+	config := Config{Connection: Connection{Downstream: Downstream{
+		Http:    Http{Port: 8080},
+		Metrics: Metrics{Port: 8080},
+	}}}
+	config.validateHTTPConfig()
+}
+
+func TestValidateMetricsPortPasses(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("config did panic for valid metrics port")
+		}
+	}()
+
+	config := Config{Connection: Connection{Downstream: Downstream{
+		Http:    Http{Port: 8080},
+		Metrics: Metrics{Port: 9090},
+	}}}
+	config.validateHTTPConfig()
+}
+
+func TestValidateMetricsPathMatchedByRoute(t *testing.T) {
+	mkConfig := func(path string, pathType string) Config {
+		route := Route{Path: path, PathType: pathType}
+		route.compilePath()
+		return Config{
+			Routes: Routes{route},
+			Connection: Connection{Downstream: Downstream{
+				Http:    Http{Port: 8080},
+				Metrics: Metrics{Enabled: true},
+			}},
+		}
+	}
+
+	var tests = []struct {
+		n        string
+		path     string
+		pathType string
+		fails    bool
+	}{
+		{"catch-all route", "/", prefixS, false},
+		{"regex catch-all route", "/.*", regexS, false},
+		{"other route", "/mse6", prefixS, false},
+		{"metrics route", "/metrics", exact, true},
+		{"prefix route", "/me", prefixS, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.fails {
+					t.Errorf("config panic want %v, got %v", tt.fails, r)
+				}
+			}()
+			config := mkConfig(tt.path, tt.pathType)
+			config.validateHTTPConfig()
+		})
+	}
+}
+
+func TestHasDownstreamMetrics(t *testing.T) {
+	var tests = []struct {
+		m    Metrics
+		want bool
+	}{
+		{Metrics{}, false},
+		{Metrics{Enabled: true}, true},
+		{Metrics{Enabled: true, Port: 9090}, false},
+		{Metrics{Port: 9090}, false},
+	}
+	for _, tt := range tests {
+		config := Config{Connection: Connection{Downstream: Downstream{Metrics: tt.m}}}
+		if got := config.hasDownstreamMetrics(); got != tt.want {
+			t.Errorf("downstream metrics for %+v want %v, got %v", tt.m, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package j8a
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OutlierDetection params eject upstream URLs that keep failing real traffic from load balancing for a while.
+type OutlierDetection struct {
+	// ConsecutiveErrors is the number of 5xx responses or connection errors in a row that ejects an upstream. Defaults to 5
+	ConsecutiveErrors int
+
+	// BaseEjectionSeconds is the ejection time, multiplied by the number of times the upstream was ejected. The count
+	// decays by one for every base ejection time the upstream serves without being ejected again. Defaults to 30
+	BaseEjectionSeconds int
+
+	// BaseEjection is BaseEjectionSeconds as a duration. Takes precedence over BaseEjectionSeconds.
+	BaseEjection Duration
+
+	// MaxEjectionSeconds caps the growing ejection time. Defaults to 300
+	MaxEjectionSeconds int
+
+	// MaxEjection is MaxEjectionSeconds as a duration. Takes precedence over MaxEjectionSeconds.
+	MaxEjection Duration
+
+	// MaxEjectionPercent is the largest share of a resource's URLs that may be ejected at once. Defaults to 50
+	MaxEjectionPercent int
+}
+
+func (od OutlierDetection) baseEjectionDuration() time.Duration {
+	return durationOrSeconds(od.BaseEjection, od.BaseEjectionSeconds)
+}
+
+func (od OutlierDetection) maxEjectionDuration() time.Duration {
+	return durationOrSeconds(od.MaxEjection, od.MaxEjectionSeconds)
+}
+
+// Outliers keeps passive failure counts and ejections per upstream URL.String().
+type Outliers struct {
+	lock    sync.Mutex
+	params  OutlierDetection
+	entries map[string]*outlier
+}
+
+type outlier struct {
+	resource    string
+	url         URL
+	consecutive int
+	ejections   int
+	until       time.Time
+}
+
+// UpstreamEjection is a currently ejected upstream, exposed on /about.
+type UpstreamEjection struct {
+	Resource  string
+	URL       string
+	Ejections int
+	Until     time.Time
+}
+
+const upEjections = "upEjections"
+const upstreamEjected = "upstream resource %s ejected for %s after %d consecutive errors"
+const upstreamEjectionSkipped = "upstream resource %s not ejected after %d consecutive errors, max ejection percent %d reached"
+
+// NewOutliers creates outlier detection with validated params.
+func NewOutliers(params OutlierDetection) *Outliers {
+	return &Outliers{
+		params:  params,
+		entries: make(map[string]*outlier),
+	}
+}
+
+func (runtime *Runtime) initOutliers() *Runtime {
+	if runtime.Connection.Upstream.OutlierDetection != nil {
+		runtime.Outliers = NewOutliers(*runtime.Connection.Upstream.OutlierDetection)
+	}
+	return runtime
+}
+
+func (o *outlier) isEjected(now time.Time) bool {
+	return now.Before(o.until)
+}
+
+// decay forgets one past ejection for every base interval the upstream served since its last ejection ended.
+func (o *outlier) decay(now time.Time, base time.Duration) {
+	if o.ejections == 0 || base <= 0 || o.isEjected(now) {
+		return
+	}
+	clean := int(now.Sub(o.until) / base)
+	if clean > 0 {
+		o.ejections = max(o.ejections-clean, 0)
+		o.until = o.until.Add(time.Duration(clean) * base)
+	}
+}
+
+// isEjected tells if the upstream URL is currently taken out of load balancing.
+func (ol *Outliers) isEjected(u URL) bool {
+	if ol == nil {
+		return false
+	}
+	ol.lock.Lock()
+	defer ol.lock.Unlock()
+	if o, ok := ol.entries[u.String()]; ok {
+		return o.isEjected(time.Now())
+	}
+	return false
+}
+
+// record counts the outcome of an upstream attempt of a resource and ejects the URL once it reaches
+// ConsecutiveErrors, unless that ejects more than MaxEjectionPercent of the resource's mappings.
+func (ol *Outliers) record(resource string, mappings []ResourceMapping, u URL, outcome attemptOutcome) {
+	if ol == nil || outcome == attemptIgnored {
+		return
+	}
+	ol.lock.Lock()
+	defer ol.lock.Unlock()
+
+	o, ok := ol.entries[u.String()]
+	if !ok {
+		o = &outlier{resource: resource, url: u}
+		ol.entries[u.String()] = o
+	}
+	if outcome == attemptSuccess {
+		o.consecutive = 0
+		return
+	}
+
+	now := time.Now()
+	o.consecutive++
+	if o.consecutive < ol.params.ConsecutiveErrors || o.isEjected(now) {
+		return
+	}
+	if !ol.mayEject(mappings, now) {
+		log.Warn().
+			Str(upResource, u.String()).
+			Msgf(upstreamEjectionSkipped, resource, o.consecutive, ol.params.MaxEjectionPercent)
+		return
+	}
+
+	base := ol.params.baseEjectionDuration()
+	o.decay(now, base)
+	o.ejections++
+	ejection := base * time.Duration(o.ejections)
+	if max := ol.params.maxEjectionDuration(); ejection > max {
+		ejection = max
+	}
+	o.resource = resource
+	o.until = now.Add(ejection)
+	log.Warn().
+		Str(upResource, u.String()).
+		Int(upEjections, o.ejections).
+		Msgf(upstreamEjected, resource, ejection, o.consecutive)
+	o.consecutive = 0
+}
+
+// mayEject tells if one more URL of the resource mappings can be ejected within MaxEjectionPercent.
+func (ol *Outliers) mayEject(mappings []ResourceMapping, now time.Time) bool {
+	if len(mappings) == 0 {
+		return false
+	}
+	ejected := 0
+	for _, m := range mappings {
+		if o, ok := ol.entries[m.URL.String()]; ok && o.isEjected(now) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= ol.params.MaxEjectionPercent*len(mappings)
+}
+
+func (ol *Outliers) report() []UpstreamEjection {
+	if ol == nil {
+		return nil
+	}
+	ol.lock.Lock()
+	defer ol.lock.Unlock()
+	now := time.Now()
+	var report []UpstreamEjection
+	for _, o := range ol.entries {
+		if o.isEjected(now) {
+			report = append(report, UpstreamEjection{
+				Resource:  o.resource,
+				URL:       o.url.String(),
+				Ejections: o.ejections,
+				Until:     o.until,
+			})
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].URL < report[j].URL
+	})
+	return report
+}
+
+// recordOutlierOutcome feeds the current upstream attempt into outlier detection.
+func (proxy *Proxy) recordOutlierOutcome() {
+	if proxy.Route == nil || proxy.Up.Atmpt == nil || proxy.Up.Atmpt.URL == nil {
+		return
+	}
+	rt := proxy.runtime()
+	rt.Outliers.record(proxy.Route.Resource, rt.Resources[proxy.Route.Resource], *proxy.Up.Atmpt.URL, proxy.attemptOutcome())
+}
@@ -0,0 +1,122 @@
+package j8a
+
+import (
+	"testing"
+	"time"
+)
+
+func mockOutlierRuntime() []URL {
+	Runner = mockRuntime()
+	urls := []URL{
+		{Scheme: "http", Host: "localhost", Port: "62001"},
+		{Scheme: "http", Host: "localhost", Port: "62002"},
+		{Scheme: "http", Host: "localhost", Port: "62003"},
+		{Scheme: "http", Host: "localhost", Port: "62004"},
+	}
+	var mappings []ResourceMapping
+	for _, u := range urls {
+		mappings = append(mappings, ResourceMapping{Name: "r1", URL: u})
+	}
+	Runner.Resources["r1"] = mappings
+	return urls
+}
+
+func TestOutlierEjectedAfterConsecutiveErrors(t *testing.T) {
+	urls := mockOutlierRuntime()
+	ol := NewOutliers(OutlierDetection{ConsecutiveErrors: 3, BaseEjectionSeconds: 30, MaxEjectionSeconds: 300, MaxEjectionPercent: 50})
+
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptSuccess)
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	if ol.isEjected(urls[0]) {
+		t.Error("upstream should not be ejected when errors are not consecutive")
+	}
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	if !ol.isEjected(urls[0]) {
+		t.Error("upstream should be ejected after consecutive errors")
+	}
+	if r := ol.report(); len(r) != 1 || r[0].URL != urls[0].String() {
+		t.Errorf("report should show ejected upstream, got %v", r)
+	}
+}
+
+func TestOutlierEjectionTimeGrows(t *testing.T) {
+	urls := mockOutlierRuntime()
+	ol := NewOutliers(OutlierDetection{ConsecutiveErrors: 1, BaseEjectionSeconds: 30, MaxEjectionSeconds: 70, MaxEjectionPercent: 50})
+
+	wants := []time.Duration{30 * time.Second, 60 * time.Second, 70 * time.Second}
+	for i, want := range wants {
+		ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+		o := ol.entries[urls[0].String()]
+		got := time.Until(o.until)
+		if got > want || got < want-time.Second {
+			t.Errorf("ejection %d want %v, got %v", i+1, want, got)
+		}
+		//ejection has passed
+		o.until = time.Now()
+	}
+}
+
+func TestOutlierEjectionCountDecays(t *testing.T) {
+	urls := mockOutlierRuntime()
+	ol := NewOutliers(OutlierDetection{ConsecutiveErrors: 1, BaseEjectionSeconds: 30, MaxEjectionSeconds: 300, MaxEjectionPercent: 50})
+
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	o := ol.entries[urls[0].String()]
+	o.until = time.Now()
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+
+	//ejection ended one clean interval ago
+	o.until = time.Now().Add(-31 * time.Second)
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+	if o.ejections != 2 {
+		t.Errorf("ejection count should decay after a clean interval, want 2, got %d", o.ejections)
+	}
+	if got := time.Until(o.until); got > 60*time.Second || got < 59*time.Second {
+		t.Errorf("ejection after decay want 60s, got %v", got)
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	urls := mockOutlierRuntime()
+	ol := NewOutliers(OutlierDetection{ConsecutiveErrors: 1, BaseEjectionSeconds: 30, MaxEjectionSeconds: 300, MaxEjectionPercent: 50})
+
+	for _, u := range urls {
+		ol.record("r1", Runner.Resources["r1"], u, attemptFailure)
+	}
+	ejected := 0
+	for _, u := range urls {
+		if ol.isEjected(u) {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("max ejection percent 50 of 4 upstreams should eject 2, got %d", ejected)
+	}
+}
+
+func TestOutlierIgnoredOutcome(t *testing.T) {
+	urls := mockOutlierRuntime()
+	ol := NewOutliers(OutlierDetection{ConsecutiveErrors: 1, BaseEjectionSeconds: 30, MaxEjectionSeconds: 300, MaxEjectionPercent: 50})
+
+	ol.record("r1", Runner.Resources["r1"], urls[0], attemptIgnored)
+	if ol.isEjected(urls[0]) {
+		t.Error("ignored outcomes should not eject upstream")
+	}
+}
+
+func TestMapURLSkipsEjectedOutlier(t *testing.T) {
+	urls := mockOutlierRuntime()
+	Runner.Outliers = NewOutliers(OutlierDetection{ConsecutiveErrors: 1, BaseEjectionSeconds: 30, MaxEjectionSeconds: 300, MaxEjectionPercent: 50})
+	Runner.Outliers.record("r1", Runner.Resources["r1"], urls[0], attemptFailure)
+
+	proxy := Proxy{}
+	for i := 0; i < 4; i++ {
+		got, _, _ := Route{Path: "/", Resource: "r1"}.mapURL(&proxy)
+		if *got == urls[0] {
+			t.Errorf("ejected upstream %v should not be mapped", urls[0])
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package j8a
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Probes params for the built-in liveness and readiness endpoints.
+type Probes struct {
+	// LivenessPath reports if the server is alive, i.e. /healthz. Off unless configured
+	LivenessPath string
+
+	// ReadinessPath reports if the server is ready to serve traffic, i.e. /readyz. Off unless configured
+	ReadinessPath string
+}
+
+const probeState = "state"
+const probeTls = "tls"
+const probeJwks = "jwks"
+const probeResource = "resource"
+
+const probeServerState = "server state %s"
+const probeTlsCertNotLoaded = "tls certificate not loaded"
+const probeJwksNotLoaded = "no keys loaded from jwks URL %s"
+const probeNoAvailableUpstream = "no available upstream"
+
+// ProbeCheck is the outcome of one liveness or readiness check.
+type ProbeCheck struct {
+	Name    string
+	Ok      bool
+	Message string `json:",omitempty"`
+}
+
+// ProbeResponse is a StatusCodeResponse with the checks that decided the status code.
+type ProbeResponse struct {
+	StatusCodeResponse
+	Checks []ProbeCheck
+}
+
+// AsJSON renders the probe response into a JSON string as []byte
+func (probeResponse ProbeResponse) AsJSON() []byte {
+	probeResponse.ServerID = ID
+	probeResponse.Version = Version
+	probeResponse.J8a = RandomHuttese()
+	response, _ := json.Marshal(probeResponse)
+	//typo fix so we can continue to use json.Marshal which needs Uppercase struct props
+	response[2] = 0x6a
+	return response
+}
+
+func (runtime *Runtime) isProbe(path string, r *http.Request) bool {
+	return len(path) > 0 && r.URL.Path == path
+}
+
+// livenessChecks pass until the server shuts down. A draining server is still alive.
+func (runtime *Runtime) livenessChecks() []ProbeCheck {
+	state := runtime.StateHandler.current()
+	return []ProbeCheck{{
+		Name:    probeState,
+		Ok:      state != Shutdown,
+		Message: fmt.Sprintf(probeServerState, state),
+	}}
+}
+
+// readinessChecks pass if listeners are up and not draining, the tls certificate and all jwks keys are loaded,
+// and every resource has at least one available upstream.
+func (runtime *Runtime) readinessChecks() []ProbeCheck {
+	state := runtime.StateHandler.current()
+	checks := []ProbeCheck{{
+		Name:    probeState,
+		Ok:      state == Daemon,
+		Message: fmt.Sprintf(probeServerState, state),
+	}}
+
+	if runtime.isTLSOn() {
+		c := ProbeCheck{Name: probeTls, Ok: runtime.ReloadableCert != nil && runtime.ReloadableCert.Cert != nil}
+		if !c.Ok {
+			c.Message = probeTlsCertNotLoaded
+		}
+		checks = append(checks, c)
+	}
+
+	for _, name := range sortedKeys(runtime.Jwt) {
+		jwt := runtime.Jwt[name]
+		if len(jwt.JwksUrl) == 0 {
+			continue
+		}
+		c := ProbeCheck{Name: probeJwks + " " + name, Ok: jwt.hasKeys()}
+		if !c.Ok {
+			c.Message = fmt.Sprintf(probeJwksNotLoaded, jwt.JwksUrl)
+		}
+		checks = append(checks, c)
+	}
+
+	for _, name := range sortedKeys(runtime.Resources) {
+		c := ProbeCheck{Name: probeResource + " " + name}
+		for _, mapping := range runtime.Resources[name] {
+			if runtime.isUpstreamAvailable(mapping.URL) {
+				c.Ok = true
+				break
+			}
+		}
+		if !c.Ok {
+			c.Message = probeNoAvailableUpstream
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	probeHandler(w, r, requestRuntime(r).livenessChecks())
+}
+
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	probeHandler(w, r, requestRuntime(r).readinessChecks())
+}
+
+func probeHandler(w http.ResponseWriter, r *http.Request, checks []ProbeCheck) {
+	code := 200
+	var failed []string
+	for _, c := range checks {
+		if !c.Ok {
+			code = 503
+			failed = append(failed, c.Name)
+		}
+	}
+
+	res := ProbeResponse{Checks: checks}
+	res.State = requestRuntime(r).StateHandler.current()
+	res.withCode(code)
+	if len(failed) > 0 {
+		res.Message = res.Message + ", failed " + strings.Join(failed, ", ")
+	}
+	sendEncodedResponse(w, r, code, res.Message, applicationJSON, res.AsJSON)
+}
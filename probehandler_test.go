@@ -0,0 +1,159 @@
+package j8a
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func probeRuntime(state State) *Runtime {
+	rt := mockRuntime()
+	rt.StateHandler = NewStateHandler()
+	rt.StateHandler.setState(state)
+	rt.Connection.Downstream.Probes = Probes{LivenessPath: "/healthz", ReadinessPath: "/readyz"}
+	return rt
+}
+
+func getProbe(t *testing.T, path string) (int, ProbeResponse) {
+	server := httptest.NewServer(HandlerDelegate{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get(contentType); got != applicationJSON {
+		t.Errorf("want content type %v, got %v", applicationJSON, got)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var pr ProbeResponse
+	if err := json.Unmarshal(body, &pr); err != nil {
+		t.Fatalf("probe response not JSON, cause: %v", err)
+	}
+	return resp.StatusCode, pr
+}
+
+func TestLivenessProbeDaemonIsAlive(t *testing.T) {
+	Runner = probeRuntime(Daemon)
+	code, pr := getProbe(t, "/healthz")
+	if code != 200 || pr.Code != 200 || pr.Message != "ok" {
+		t.Errorf("want 200 ok, got %d %+v", code, pr)
+	}
+}
+
+func TestLivenessProbeDrainingIsAlive(t *testing.T) {
+	Runner = probeRuntime(Draining)
+	if code, _ := getProbe(t, "/healthz"); code != 200 {
+		t.Errorf("draining server should be alive, got %d", code)
+	}
+}
+
+func TestReadinessProbeDrainingIsNotReady(t *testing.T) {
+	Runner = probeRuntime(Draining)
+	code, pr := getProbe(t, "/readyz")
+	if code != 503 || pr.Code != 503 {
+		t.Errorf("draining server should not be ready, got %d", code)
+	}
+	if pr.State != Draining || !strings.Contains(pr.Message, probeState) {
+		t.Errorf("response should report draining state, got %+v", pr)
+	}
+}
+
+func TestReadinessProbeDaemonIsReady(t *testing.T) {
+	Runner = probeRuntime(Daemon)
+	code, pr := getProbe(t, "/readyz")
+	if code != 200 {
+		t.Errorf("want 200, got %d %+v", code, pr)
+	}
+	if len(pr.Checks) != 1+len(Runner.Resources) {
+		t.Errorf("want state and resource checks, got %+v", pr.Checks)
+	}
+}
+
+func TestReadinessChecksUnhealthyResource(t *testing.T) {
+	Runner = probeRuntime(Daemon)
+	u := Runner.Resources["blahResource"][0].URL
+	Runner.Resources["blahResource"][0].HealthCheck = &HealthCheck{UnhealthyThreshold: 1}
+	Runner.HealthChecks = NewHealthChecks(Runner.Resources)
+	Runner.HealthChecks.update(Runner.HealthChecks.states[u.String()], false, "test")
+
+	for _, c := range Runner.readinessChecks() {
+		if c.Name == probeResource+" blahResource" && c.Ok {
+			t.Errorf("resource without available upstream should fail readiness")
+		}
+	}
+}
+
+func TestReadinessChecksJwksNotLoaded(t *testing.T) {
+	Runner = probeRuntime(Daemon)
+	Runner.Jwt = map[string]*Jwt{"jwks": {Name: "jwks", JwksUrl: "http://localhost:60083/jwks.json"}}
+
+	found := false
+	for _, c := range Runner.readinessChecks() {
+		if c.Name == probeJwks+" jwks" {
+			found = true
+			if c.Ok {
+				t.Errorf("jwt without jwks keys should fail readiness")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("jwks check missing")
+	}
+}
+
+func TestReadinessChecksTlsCertNotLoaded(t *testing.T) {
+	Runner = probeRuntime(Daemon)
+	Runner.Connection.Downstream.Tls.Port = 65533
+	Runner.ReloadableCert.Cert = nil
+
+	for _, c := range Runner.readinessChecks() {
+		if c.Name == probeTls && c.Ok {
+			t.Errorf("tls without certificate should fail readiness")
+		}
+	}
+}
+
+func TestProbesOffUnlessConfigured(t *testing.T) {
+	config := new(Config).setDefaultDownstreamParams()
+	if p := config.Connection.Downstream.Probes; len(p.LivenessPath) > 0 || len(p.ReadinessPath) > 0 {
+		t.Errorf("probes should be off unless configured, got %+v", p)
+	}
+}
+
+func TestValidateProbePathMatchedByRoute(t *testing.T) {
+	var tests = []struct {
+		n      string
+		probes Probes
+		fails  bool
+	}{
+		{"no probes", Probes{}, false},
+		{"other paths", Probes{LivenessPath: "/livez", ReadinessPath: "/readyz"}, false},
+		{"liveness matched", Probes{LivenessPath: "/healthz"}, true},
+		{"readiness matched", Probes{ReadinessPath: "/healthz/ready"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.fails {
+					t.Errorf("config panic want %v, got %v", tt.fails, r)
+				}
+			}()
+			route := Route{Path: "/healthz", PathType: prefixS}
+			route.compilePath()
+			config := Config{
+				Routes: Routes{route},
+				Connection: Connection{Downstream: Downstream{
+					Http:   Http{Port: 8080},
+					Probes: tt.probes,
+				}},
+			}
+			config.validateHTTPConfig()
+		})
+	}
+}
@@ -11,10 +11,14 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 	unicode "unicode"
 
@@ -198,16 +202,28 @@ type Atmpt struct {
 	ContentEncoding ContentEncoding
 	resp            *http.Response
 	respBody        *[]byte
+	respBodyBytes   int64
+	err             error
 	CompleteHeader  chan struct{}
 	CompleteBody    chan struct{}
 	Aborted         <-chan struct{}
 	AbortedFlag     bool
 	CancelFunc      func()
 	startDate       time.Time
+	span            *span
+	maxAttempts     int
 }
 
 func (atmpt Atmpt) print() string {
-	return fmt.Sprintf("%d/%d", atmpt.Count, Runner.Connection.Upstream.MaxAttempts)
+	return fmt.Sprintf("%d/%d", atmpt.Count, atmpt.maxAttempts)
+}
+
+// respBodyLen is the size of the upstream response body, whether it was buffered or streamed.
+func (atmpt Atmpt) respBodyLen() int {
+	if atmpt.respBody != nil {
+		return len(*atmpt.respBody)
+	}
+	return int(atmpt.respBodyBytes)
 }
 
 // Resp wraps downstream http response writer and data
@@ -218,6 +234,8 @@ type Resp struct {
 	Body            *[]byte
 	ContentLength   int64
 	ContentEncoding ContentEncoding
+	// Committed is set once the status code was sent downstream. No retries are possible after this.
+	Committed bool
 }
 
 // Up wraps upstream
@@ -242,7 +260,11 @@ type Down struct {
 	AbortedFlag    bool
 	Timeout        <-chan struct{}
 	TimeoutFlag    bool
+	timeoutTimer   *time.Timer
 	ReqTooLarge    bool
+	bodyStream     *dwnBodyStream
+	bodySpill      *os.File
+	bodySpillBytes int64
 	startDate      time.Time
 	HttpVer        string
 	TlsVer         string
@@ -257,6 +279,18 @@ type Proxy struct {
 	Up           Up
 	Dwn          Down
 	Route        *Route
+	trace        *traceContext
+	span         *span
+	token        jwt.Token
+	rt           *Runtime
+}
+
+// runtime is the Runtime the proxy started with, so config reloads don't change in-flight requests.
+func (proxy *Proxy) runtime() *Runtime {
+	if proxy.rt == nil {
+		return currentRuntime()
+	}
+	return proxy.rt
 }
 
 func (proxy *Proxy) hasDownstreamAbortedOrTimedout() bool {
@@ -279,6 +313,9 @@ func (proxy *Proxy) hasDownstreamAbortedOrTimedout() bool {
 
 func (proxy *Proxy) resolveUpstreamURI() string {
 	uri := proxy.Up.Atmpt.URL.String() + proxy.Dwn.URI
+	if len(proxy.Route.CompiledTransform) > 0 {
+		return proxy.Up.Atmpt.URL.String() + proxy.Route.transformURI(proxy.Dwn.URI)
+	}
 	if len(proxy.Route.Transform) > 0 {
 		t := proxy.Route.Transform
 		if t == "/" {
@@ -317,24 +354,21 @@ const upstreamRetriesStopped = "upstream retries stopped"
 
 func (proxy *Proxy) shouldRetryUpstreamAttempt() bool {
 
-	// part one is checking for repeatable methods. we don't retry i.e. POST
-	retry := false
-Retry:
-	for _, method := range httpRepeatableMethods {
-		if proxy.Dwn.Method == method {
-			if proxy.Up.Atmpt.Count < Runner.Connection.Upstream.MaxAttempts {
-				retry = true
-				break Retry
-			}
-			retry = false
-		}
-	}
+	// part one is checking for repeatable methods. we don't retry i.e. POST unless the route allows it
+	retry := proxy.Up.Atmpt.Count < proxy.maxAttempts() &&
+		proxy.hasRetryableMethod() &&
+		proxy.hasRetryableUpstreamError()
 
 	// once downstream context has signalled, do not re-attempt upstream
 	if proxy.hasDownstreamAbortedOrTimedout() {
 		retry = false
 	}
 
+	// once the first byte was sent downstream we cannot start over
+	if proxy.Dwn.Resp.Committed {
+		retry = false
+	}
+
 	if !retry {
 		scaffoldUpAttemptLog(proxy).
 			Msg(upstreamRetriesStopped)
@@ -343,6 +377,94 @@ Retry:
 	return retry
 }
 
+// attemptOutcome tells how an upstream attempt counts towards circuit breakers and outlier detection.
+type attemptOutcome int
+
+const (
+	attemptSuccess attemptOutcome = iota
+	attemptFailure
+	attemptIgnored
+)
+
+// attemptOutcome of the current upstream attempt. Attempts cut short by downstream events say nothing about
+// the upstream.
+func (proxy *Proxy) attemptOutcome() attemptOutcome {
+	if proxy.Dwn.AbortedFlag || proxy.Dwn.TimeoutFlag {
+		return attemptIgnored
+	}
+	if proxy.Up.Atmpt.err != nil || proxy.Up.Atmpt.AbortedFlag || proxy.Up.Atmpt.StatusCode >= 500 {
+		return attemptFailure
+	}
+	return attemptSuccess
+}
+
+const idempotencyKey = "Idempotency-Key"
+
+func (proxy *Proxy) routeRetry() *Retry {
+	if proxy.Route == nil {
+		return nil
+	}
+	return proxy.Route.Retry
+}
+
+func (proxy *Proxy) hasRetryableMethod() bool {
+	if proxy.hasRepeatableMethod() {
+		return true
+	}
+	retry := proxy.routeRetry()
+	if retry == nil {
+		return false
+	}
+	//streamed bodies cannot be replayed once the upstream started reading them
+	if retry.IdempotencyKey && proxy.Dwn.bodyStream == nil &&
+		proxy.Dwn.Req != nil && len(proxy.Dwn.Req.Header.Get(idempotencyKey)) > 0 {
+		return true
+	}
+	return retry.NonIdempotent && proxy.hasUpstreamRequestNotSent()
+}
+
+func (proxy *Proxy) hasRetryableUpstreamError() bool {
+	class := proxy.upstreamErrorClass()
+	if len(class) == 0 {
+		return true
+	}
+	return proxy.routeRetry().retriesErrorClass(class)
+}
+
+// upstreamErrorClass sorts the failure of the current attempt into one of the retry error classes. Returns
+// an empty string for upstream responses with status codes and otherUpstreamError if the error cannot be classified.
+func (proxy *Proxy) upstreamErrorClass() string {
+	err := proxy.Up.Atmpt.err
+	var ne net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return connectRefused
+	case proxy.Up.Atmpt.AbortedFlag,
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &ne) && ne.Timeout():
+		return readTimeout
+	case errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		err != nil && strings.Contains(err.Error(), eofS):
+		return upstreamHangupS
+	case err != nil:
+		return otherUpstreamError
+	}
+	return emptyString
+}
+
+// hasUpstreamRequestNotSent tells if the current attempt failed before a connection to upstream was made.
+func (proxy *Proxy) hasUpstreamRequestNotSent() bool {
+	err := proxy.Up.Atmpt.err
+	var oe *net.OpError
+	var de *net.DNSError
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &de) ||
+		(errors.As(err, &oe) && oe.Op == "dial")
+}
+
 func (proxy *Proxy) hasMadeUpstreamAttempt() bool {
 	return proxy.Up.Atmpt != nil && proxy.Up.Atmpt.resp != nil
 }
@@ -354,20 +476,29 @@ const path = "path"
 
 // ParseIncoming is a factory method for a new ProxyRequest, embeds the incoming request.
 func (proxy *Proxy) parseIncoming(request *http.Request) *Proxy {
+	proxy.parseIncomingHeaders(request)
+	proxy.parseRequestBody(request)
+	return proxy
+}
+
+// parseIncomingHeaders embeds the incoming request without reading its body.
+func (proxy *Proxy) parseIncomingHeaders(request *http.Request) *Proxy {
 	proxy.Dwn.startDate = time.Now()
+	proxy.rt = requestRuntime(request)
 	proxy.XRequestID = createXRequestID(request)
+	proxy.startTrace(request)
 
-	//set request new request context for timeout
+	//set request new request context for timeout. the route may re-arm it once matched.
 	ctx, cancel := context.WithCancel(context.TODO())
 	proxy.Dwn.Timeout = ctx.Done()
-	time.AfterFunc(Runner.getDownstreamRoundTripTimeoutDuration(), func() {
+	proxy.Dwn.timeoutTimer = time.AfterFunc(proxy.downstreamRoundTripTimeoutDuration(), func() {
 		cancel()
 	})
 
 	//this is separate context for abort. abort is manual close
 	proxy.Dwn.Aborted = request.Context().Done()
 
-	if !Runner.DisableXRequestInfo {
+	if !proxy.runtime().DisableXRequestInfo {
 		proxy.XRequestInfo = parseXRequestInfo(request)
 	}
 	proxy.Dwn.Host = parseHost(request)
@@ -379,7 +510,7 @@ func (proxy *Proxy) parseIncoming(request *http.Request) *Proxy {
 	proxy.Dwn.UserAgent = parseUserAgent(request)
 	proxy.Dwn.Method = parseMethod(request)
 	proxy.Dwn.Listener = parseListener(request)
-	proxy.Dwn.Port = parsePort(request)
+	proxy.Dwn.Port = parsePort(request, proxy.runtime().Connection.Downstream)
 	proxy.Dwn.Req = request
 	proxy.Dwn.AbortedFlag = false
 
@@ -389,8 +520,6 @@ func (proxy *Proxy) parseIncoming(request *http.Request) *Proxy {
 		Str(XRequestID, proxy.XRequestID).
 		Msg(headerParsed)
 
-	proxy.parseRequestBody(request)
-
 	return proxy
 }
 
@@ -412,11 +541,11 @@ func parseAcceptEncoding(request *http.Request) AcceptEncoding {
 	return ae
 }
 
-func parsePort(request *http.Request) int {
+func parsePort(request *http.Request, downstream Downstream) int {
 	if request.TLS == nil {
-		return Runner.Connection.Downstream.Http.Port
+		return downstream.Http.Port
 	} else {
-		return Runner.Connection.Downstream.Tls.Port
+		return downstream.Tls.Port
 	}
 }
 
@@ -447,12 +576,22 @@ func (proxy *Proxy) parseRequestBody(request *http.Request) {
 	}
 
 	//only try to parse the request if supplied content-length is within limits
-	if request.ContentLength >= Runner.Connection.Downstream.MaxBodyBytes {
+	if request.ContentLength >= proxy.maxBodyBytes() {
 		proxy.Dwn.ReqTooLarge = true
 		infoOrTraceEv(proxy).
 			Str(XRequestID, proxy.XRequestID).
 			Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
-			Msgf(dwnBodyContentLengthExceedsMaxBytes, request.ContentLength, Runner.Connection.Downstream.MaxBodyBytes)
+			Msgf(dwnBodyContentLengthExceedsMaxBytes, request.ContentLength, proxy.maxBodyBytes())
+		return
+	}
+
+	//routes with streamRequest pass the body on as it arrives instead of reading it into memory.
+	if proxy.shouldStreamRequestBody() {
+		if proxy.hasRepeatableMethod() {
+			proxy.spillRequestBody(request)
+		} else {
+			proxy.streamRequestBody(request)
+		}
 		return
 	}
 
@@ -460,7 +599,7 @@ func (proxy *Proxy) parseRequestBody(request *http.Request) {
 	//No need to close request.Body of type io.ReadCloser, see: https://golang.org/pkg/net/http/#Request
 	bodyReader := bufio.NewReader(http.MaxBytesReader(proxy.Dwn.Resp.Writer,
 		request.Body,
-		Runner.Connection.Downstream.MaxBodyBytes))
+		proxy.maxBodyBytes()))
 
 	var err error
 	var buf []byte
@@ -469,27 +608,16 @@ func (proxy *Proxy) parseRequestBody(request *http.Request) {
 
 	buf, err = ioutil.ReadAll(bodyReader)
 	n := len(buf)
-	if int64(n) > Runner.Connection.Downstream.MaxBodyBytes {
+	if int64(n) > proxy.maxBodyBytes() {
 		proxy.Dwn.ReqTooLarge = true
 		infoOrTraceEv(proxy).
 			Str(path, proxy.Dwn.Path).
 			Str(method, proxy.Dwn.Method).
 			Str(XRequestID, proxy.XRequestID).
 			Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
-			Msgf(dwnBodyTooLarge, n, Runner.Connection.Downstream.MaxBodyBytes)
+			Msgf(dwnBodyTooLarge, n, proxy.maxBodyBytes())
 	} else if err != nil && err != io.EOF {
-		ev := infoOrTraceEv(proxy).
-			Str(path, proxy.Dwn.Path).
-			Str(method, proxy.Dwn.Method).
-			Str(XRequestID, proxy.XRequestID).
-			Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds())
-		if strings.Contains(err.Error(), timeout) {
-			proxy.Dwn.TimeoutFlag = true
-			ev.Msgf(dwnBodyReadTimeout, err)
-		} else {
-			proxy.Dwn.AbortedFlag = true
-			ev.Msgf(dwnBodyReadAbort, err)
-		}
+		proxy.flagRequestBodyReadError(err, int64(n))
 	} else {
 		proxy.Dwn.Body = buf
 		infoOrTraceEv(proxy).
@@ -503,6 +631,170 @@ func (proxy *Proxy) parseRequestBody(request *http.Request) {
 
 }
 
+// flagRequestBodyReadError records why reading the downstream request body failed after n bytes.
+func (proxy *Proxy) flagRequestBodyReadError(err error, n int64) {
+	ev := infoOrTraceEv(proxy).
+		Str(path, proxy.Dwn.Path).
+		Str(method, proxy.Dwn.Method).
+		Str(XRequestID, proxy.XRequestID).
+		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds())
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		proxy.Dwn.ReqTooLarge = true
+		ev.Msgf(dwnBodyTooLarge, n, proxy.maxBodyBytes())
+	} else if strings.Contains(err.Error(), timeout) {
+		proxy.Dwn.TimeoutFlag = true
+		ev.Msgf(dwnBodyReadTimeout, err)
+	} else {
+		proxy.Dwn.AbortedFlag = true
+		ev.Msgf(dwnBodyReadAbort, err)
+	}
+}
+
+func (proxy *Proxy) shouldStreamRequestBody() bool {
+	return proxy.Route != nil && proxy.Route.StreamRequest
+}
+
+func (proxy *Proxy) hasRepeatableMethod() bool {
+	for _, method := range httpRepeatableMethods {
+		if proxy.Dwn.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+const dwnBodyStreaming = "downstream request body streaming upstream, content-length %d"
+
+// streamRequestBody hands the downstream request body straight to the upstream request. It can only be read once
+// so the method must not be retried.
+func (proxy *Proxy) streamRequestBody(request *http.Request) {
+	proxy.Dwn.bodyStream = &dwnBodyStream{
+		proxy: proxy,
+		body: http.MaxBytesReader(proxy.Dwn.Resp.Writer,
+			request.Body,
+			proxy.maxBodyBytes()),
+		contentLength: request.ContentLength,
+	}
+	infoOrTraceEv(proxy).
+		Str(path, proxy.Dwn.Path).
+		Str(method, proxy.Dwn.Method).
+		Str(XRequestID, proxy.XRequestID).
+		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+		Msgf(dwnBodyStreaming, request.ContentLength)
+}
+
+// spillThresholdBytes is the largest streamed request body kept in memory for repeatable methods.
+const spillThresholdBytes = 64 << 10
+const spillFilePattern = "j8a-body-*"
+const dwnBodySpilled = "downstream request body spilled to temp file %s"
+const dwnBodySpillFailed = "downstream request body unable to spill to temp file, cause: %v"
+
+// spillRequestBody reads the body of a repeatable method so that it can be replayed for retries. Bodies beyond
+// spillThresholdBytes go to a temp file rather than memory, both are bounded by MaxBodyBytes.
+func (proxy *Proxy) spillRequestBody(request *http.Request) {
+	body := http.MaxBytesReader(proxy.Dwn.Resp.Writer,
+		request.Body,
+		proxy.maxBodyBytes())
+
+	buf, err := ioutil.ReadAll(io.LimitReader(body, spillThresholdBytes+1))
+	n := int64(len(buf))
+	if err != nil {
+		proxy.flagRequestBodyReadError(err, n)
+		return
+	}
+
+	if n <= spillThresholdBytes {
+		proxy.Dwn.Body = buf
+	} else {
+		spill, err := os.CreateTemp("", spillFilePattern)
+		if err != nil {
+			log.Warn().
+				Str(XRequestID, proxy.XRequestID).
+				Msgf(dwnBodySpillFailed, err)
+			proxy.Dwn.AbortedFlag = true
+			return
+		}
+		proxy.Dwn.bodySpill = spill
+
+		var m int64
+		if _, err = spill.Write(buf); err == nil {
+			m, err = io.Copy(spill, body)
+			n += m
+		}
+		if err != nil {
+			proxy.flagRequestBodyReadError(err, n)
+			return
+		}
+		proxy.Dwn.bodySpillBytes = n
+		infoOrTraceEv(proxy).
+			Str(XRequestID, proxy.XRequestID).
+			Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+			Msgf(dwnBodySpilled, spill.Name())
+	}
+
+	infoOrTraceEv(proxy).
+		Str(path, proxy.Dwn.Path).
+		Str(method, proxy.Dwn.Method).
+		Str(XRequestID, proxy.XRequestID).
+		Int64(bodyBytes, n).
+		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+		Msgf(dwnBodyRead, n, request.ContentLength)
+}
+
+// releaseRequestBody removes any temp file the downstream request body was spilled to.
+func (proxy *Proxy) releaseRequestBody() {
+	if proxy.Dwn.bodySpill != nil {
+		proxy.Dwn.bodySpill.Close()
+		os.Remove(proxy.Dwn.bodySpill.Name())
+		proxy.Dwn.bodySpill = nil
+	}
+}
+
+// dwnBodyStream passes a downstream request body to the upstream request as it is read by the http client.
+type dwnBodyStream struct {
+	proxy         *Proxy
+	body          io.Reader
+	contentLength int64
+	read          int64
+	tooLarge      atomic.Bool
+	done          bool
+}
+
+func (s *dwnBodyStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.read += int64(n)
+	if err == nil || s.done {
+		return n, err
+	}
+	s.done = true
+
+	proxy := s.proxy
+	ev := infoOrTraceEv(proxy).
+		Str(path, proxy.Dwn.Path).
+		Str(method, proxy.Dwn.Method).
+		Str(XRequestID, proxy.XRequestID).
+		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds())
+	var mbe *http.MaxBytesError
+	if err == io.EOF {
+		ev.Int64(bodyBytes, s.read).
+			Msgf(dwnBodyRead, s.read, s.contentLength)
+	} else if errors.As(err, &mbe) {
+		s.tooLarge.Store(true)
+		ev.Msgf(dwnBodyTooLarge, s.read, proxy.maxBodyBytes())
+	} else if strings.Contains(err.Error(), timeout) {
+		ev.Msgf(dwnBodyReadTimeout, err)
+	} else {
+		ev.Msgf(dwnBodyReadAbort, err)
+	}
+	return n, err
+}
+
+// hasStreamedBodyTooLarge tells if a streamed downstream request body exceeded MaxBodyBytes while sent upstream.
+func (proxy *Proxy) hasStreamedBodyTooLarge() bool {
+	return proxy.Dwn.bodyStream != nil && proxy.Dwn.bodyStream.tooLarge.Load()
+}
+
 func infoOrTraceEv(proxy *Proxy) *zerolog.Event {
 	var ev *zerolog.Event
 	if proxy.XRequestInfo {
@@ -621,12 +913,29 @@ func (proxy *Proxy) setOutgoing(out http.ResponseWriter) *Proxy {
 }
 
 func (proxy Proxy) bodyReader() io.Reader {
+	if proxy.Dwn.bodyStream != nil {
+		return proxy.Dwn.bodyStream
+	}
+	if proxy.Dwn.bodySpill != nil {
+		return io.NewSectionReader(proxy.Dwn.bodySpill, 0, proxy.Dwn.bodySpillBytes)
+	}
 	if len(proxy.Dwn.Body) > 0 {
 		return bytes.NewReader(proxy.Dwn.Body)
 	}
 	return nil
 }
 
+// bodyContentLength is the upstream request content-length for streamed bodies, -1 if unknown.
+func (proxy Proxy) bodyContentLength() int64 {
+	if proxy.Dwn.bodyStream != nil && proxy.Dwn.bodyStream.contentLength > 0 {
+		return proxy.Dwn.bodyStream.contentLength
+	}
+	if proxy.Dwn.bodySpill != nil {
+		return proxy.Dwn.bodySpillBytes
+	}
+	return -1
+}
+
 const upstreamAttemptInitialized = "upstream attempt initialized"
 
 func (proxy *Proxy) firstAttempt(URL *URL, label string) *Proxy {
@@ -641,13 +950,13 @@ func (proxy *Proxy) firstAttempt(URL *URL, label string) *Proxy {
 		Aborted:        make(chan struct{}),
 		CancelFunc:     nil,
 		startDate:      time.Now(),
+		maxAttempts:    proxy.maxAttempts(),
 	}
 	proxy.Up.Atmpts = []Atmpt{first}
 	proxy.Up.Atmpt = &proxy.Up.Atmpts[0]
 	proxy.Up.Count = 1
 
 	scaffoldUpAttemptLog(proxy).
-		Str(upResource, URL.String()).
 		Msg(upstreamAttemptInitialized)
 
 	return proxy
@@ -655,10 +964,71 @@ func (proxy *Proxy) firstAttempt(URL *URL, label string) *Proxy {
 
 const upAtmptCnt = "upAtmptCnt"
 
+const upstreamAttemptBackoff = "upstream attempt backoff %s before retry"
+const upstreamAttemptBackoffInterrupted = "upstream attempt backoff interrupted by downstream event"
+
+// retryBackoff is the exponential wait period with full jitter before the next attempt, capped by
+// RetryBackoffMax and the time left in the downstream round trip.
+func (proxy *Proxy) retryBackoff() time.Duration {
+	base := proxy.runtime().Connection.Upstream.retryBackoffBaseDuration()
+	max := proxy.runtime().Connection.Upstream.retryBackoffMaxDuration()
+	if base <= 0 {
+		return 0
+	}
+
+	ceiling := base
+	for i := 1; i < proxy.Up.Atmpt.Count && ceiling < max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > max {
+		ceiling = max
+	}
+	if left := time.Until(proxy.Dwn.startDate.Add(proxy.downstreamRoundTripTimeoutDuration())); ceiling > left {
+		ceiling = left
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// backoff waits before the next upstream attempt. Returns false if the downstream request aborted or timed out
+// in the meantime, so there is no point in another attempt.
+func (proxy *Proxy) backoff() bool {
+	wait := proxy.retryBackoff()
+	if wait == 0 {
+		return !proxy.hasDownstreamAbortedOrTimedout()
+	}
+	scaffoldUpAttemptLog(proxy).
+		Msgf(upstreamAttemptBackoff, wait)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return !proxy.hasDownstreamAbortedOrTimedout()
+	case <-proxy.Dwn.Timeout:
+		proxy.Dwn.TimeoutFlag = true
+	case <-proxy.Dwn.Aborted:
+		proxy.Dwn.AbortedFlag = true
+	}
+	scaffoldUpAttemptLog(proxy).
+		Msg(upstreamAttemptBackoffInterrupted)
+	return false
+}
+
 func (proxy *Proxy) nextAttempt() *Proxy {
+	url, label := proxy.Up.Atmpt.URL, proxy.Up.Atmpt.Label
+	//retries move to the next healthy upstream chosen by the load balancer, if the route has any.
+	if proxy.Route != nil {
+		if u, l, mapped := proxy.Route.remapURL(proxy); mapped {
+			url, label = u, l
+		}
+	}
+
 	next := Atmpt{
-		URL:            proxy.Up.Atmpt.URL,
-		Label:          proxy.Up.Atmpt.Label,
+		URL:            url,
+		Label:          label,
 		Count:          proxy.Up.Atmpt.Count + 1,
 		StatusCode:     0,
 		resp:           nil,
@@ -669,26 +1039,24 @@ func (proxy *Proxy) nextAttempt() *Proxy {
 		AbortedFlag:    false,
 		CancelFunc:     nil,
 		startDate:      time.Now(),
+		maxAttempts:    proxy.maxAttempts(),
 	}
 	proxy.Up.Atmpts = append(proxy.Up.Atmpts, next)
 	proxy.Up.Count = next.Count
 	proxy.Up.Atmpt = &proxy.Up.Atmpts[len(proxy.Up.Atmpts)-1]
+	proxy.observeUpstreamRetry()
 
 	scaffoldUpAttemptLog(proxy).
 		Int(upAtmptCnt, proxy.Up.Count).
-		Str(upResource, next.URL.String()).
 		Msg(upstreamAttemptInitialized)
 	return proxy
 }
 
 func (proxy *Proxy) copyUpstreamResponseHeaders() {
-	for key, values := range proxy.Up.Atmpt.resp.Header {
-		if shouldProxyHeader(key) {
-			for _, value := range values {
-				proxy.Dwn.Resp.Writer.Header().Add(key, value)
-			}
-		}
-	}
+	resp := proxy.Up.Atmpt.resp
+	copyHeaders(proxy.Dwn.Resp.Writer.Header(), resp.Header)
+	appendHeader(proxy.Dwn.Resp.Writer.Header(), via, viaValue(resp.ProtoMajor, resp.ProtoMinor))
+	proxy.Route.ResponseHeaders.apply(proxy, proxy.Dwn.Resp.Writer.Header())
 }
 
 const upstreamEncodeFlate = "upstream response body re-encoded with flate before passing downstream"
@@ -702,47 +1070,15 @@ const varyS = "Vary"
 func (proxy *Proxy) encodeUpstreamResponseBody() {
 	atmpt := *proxy.Up.Atmpt
 	if atmpt.respBody != nil && len(*atmpt.respBody) > 0 {
-
-		//we pass through all compressed responses as is, including unsupported deflate and compress codecs.
-		//this includes custom encodings, i.e. multiple compressions in series.
-		if atmpt.ContentEncoding.isEncoded() {
-			proxy.Dwn.Resp.Body = atmpt.respBody
-			proxy.Dwn.Resp.ContentEncoding = atmpt.ContentEncoding
-			scaffoldUpAttemptLog(proxy).
-				Msgf(upstreamCopyNoRecode)
-		} else if proxy.Dwn.AcceptEncoding.isCompatible(EncGzip) {
+		switch proxy.negotiateDownstreamContentEncoding() {
+		case EncGzip:
 			proxy.Dwn.Resp.Body = Gzip(*atmpt.respBody)
-			proxy.Dwn.Resp.ContentEncoding = EncGzip
-			scaffoldUpAttemptLog(proxy).
-				Msg(upstreamEncodeGzip)
-		} else if proxy.Dwn.AcceptEncoding.isCompatible(EncBrotli) {
+		case EncBrotli:
 			proxy.Dwn.Resp.Body = BrotliEncode(*atmpt.respBody)
-			proxy.Dwn.Resp.ContentEncoding = EncBrotli
-			scaffoldUpAttemptLog(proxy).
-				Msg(upstreamEncodeBr)
-		} else {
+		default:
 			proxy.Dwn.Resp.Body = atmpt.respBody
-			if len(atmpt.ContentEncoding) > 0 {
-				//only set this if it was present upstream, otherwise assume nothing and leave empty.
-				proxy.Dwn.Resp.ContentEncoding = atmpt.ContentEncoding
-			} else {
-				proxy.Dwn.Resp.ContentEncoding = EncIdentity
-			}
-			scaffoldUpAttemptLog(proxy).
-				Msgf(upstreamCopyNoRecode)
 		}
-
-		//set this when present, but do not give instructions for empty values
-		if len(proxy.Dwn.Resp.ContentEncoding) > 0 {
-			proxy.Dwn.Resp.Writer.Header().Set(contentEncoding, proxy.Dwn.Resp.ContentEncoding.print())
-		}
-
-		//send a vary header for accept encoding if final downstream content encoding
-		//doesn't match expectations for content negotiation, i.e. when upstream was passed through.
-		if !proxy.Dwn.AcceptEncoding.isCompatible(proxy.Dwn.Resp.ContentEncoding) {
-			proxy.Dwn.Resp.Writer.Header().Set(varyS, acceptEncoding)
-		}
-
+		proxy.setContentEncodingHeaders()
 	} else {
 		//just in case golang tries to use this value downstream.
 		nobody := make([]byte, 0)
@@ -752,8 +1088,135 @@ func (proxy *Proxy) encodeUpstreamResponseBody() {
 	}
 }
 
+// negotiateDownstreamContentEncoding sets the downstream content encoding for a non empty upstream response body.
+// It returns the encoding the body needs to be re-encoded with, or empty string if it is passed through as is.
+func (proxy *Proxy) negotiateDownstreamContentEncoding() ContentEncoding {
+	atmpt := proxy.Up.Atmpt
+	recode := ContentEncoding(emptyString)
+
+	//we pass through all compressed responses as is, including unsupported deflate and compress codecs.
+	//this includes custom encodings, i.e. multiple compressions in series.
+	if atmpt.ContentEncoding.isEncoded() {
+		proxy.Dwn.Resp.ContentEncoding = atmpt.ContentEncoding
+		scaffoldUpAttemptLog(proxy).
+			Msgf(upstreamCopyNoRecode)
+	} else if proxy.Dwn.AcceptEncoding.isCompatible(EncGzip) {
+		recode = EncGzip
+		proxy.Dwn.Resp.ContentEncoding = EncGzip
+		scaffoldUpAttemptLog(proxy).
+			Msg(upstreamEncodeGzip)
+	} else if proxy.Dwn.AcceptEncoding.isCompatible(EncBrotli) {
+		recode = EncBrotli
+		proxy.Dwn.Resp.ContentEncoding = EncBrotli
+		scaffoldUpAttemptLog(proxy).
+			Msg(upstreamEncodeBr)
+	} else {
+		if len(atmpt.ContentEncoding) > 0 {
+			//only set this if it was present upstream, otherwise assume nothing and leave empty.
+			proxy.Dwn.Resp.ContentEncoding = atmpt.ContentEncoding
+		} else {
+			proxy.Dwn.Resp.ContentEncoding = EncIdentity
+		}
+		scaffoldUpAttemptLog(proxy).
+			Msgf(upstreamCopyNoRecode)
+	}
+	return recode
+}
+
+func (proxy *Proxy) setContentEncodingHeaders() {
+	//set this when present, but do not give instructions for empty values
+	if len(proxy.Dwn.Resp.ContentEncoding) > 0 {
+		proxy.Dwn.Resp.Writer.Header().Set(contentEncoding, proxy.Dwn.Resp.ContentEncoding.print())
+	}
+
+	//send a vary header for accept encoding if final downstream content encoding
+	//doesn't match expectations for content negotiation, i.e. when upstream was passed through.
+	if !proxy.Dwn.AcceptEncoding.isCompatible(proxy.Dwn.Resp.ContentEncoding) {
+		proxy.Dwn.Resp.Writer.Header().Set(varyS, acceptEncoding)
+	}
+}
+
 func (proxy *Proxy) setRoute(route *Route) {
 	proxy.Route = route
+	if route.Downstream != nil && (route.Downstream.RoundTripTimeout > 0 || route.Downstream.RoundTripTimeoutSeconds > 0) {
+		proxy.rearmDownstreamTimeout()
+	}
+}
+
+// rearmDownstreamTimeout moves the downstream round trip timeout, armed before the route was known, to the route
+// override. It also moves the write deadline of the listener so the response can still be sent.
+func (proxy *Proxy) rearmDownstreamTimeout() {
+	deadline := proxy.Dwn.startDate.Add(proxy.downstreamRoundTripTimeoutDuration())
+	if proxy.Dwn.timeoutTimer != nil && proxy.Dwn.timeoutTimer.Stop() {
+		proxy.Dwn.timeoutTimer.Reset(time.Until(deadline))
+	}
+	if proxy.Dwn.Resp.Writer != nil {
+		http.NewResponseController(proxy.Dwn.Resp.Writer).SetWriteDeadline(deadline.Add(time.Second))
+	}
+}
+
+func (proxy *Proxy) routeUpstream() RouteUpstream {
+	if proxy.Route == nil || proxy.Route.Upstream == nil {
+		return RouteUpstream{}
+	}
+	return *proxy.Route.Upstream
+}
+
+func (proxy *Proxy) routeDownstream() RouteDownstream {
+	if proxy.Route == nil || proxy.Route.Downstream == nil {
+		return RouteDownstream{}
+	}
+	return *proxy.Route.Downstream
+}
+
+// overrideOr returns the route override if set, otherwise the connection param.
+func overrideOr[T int | int64 | time.Duration](override T, param T) T {
+	if override > 0 {
+		return override
+	}
+	return param
+}
+
+func (proxy *Proxy) upstreamSocketTimeout() time.Duration {
+	u := proxy.routeUpstream()
+	return overrideOr(durationOrSeconds(u.SocketTimeout, u.SocketTimeoutSeconds),
+		proxy.runtime().Connection.Upstream.socketTimeoutDuration())
+}
+
+func (proxy *Proxy) upstreamReadTimeout() time.Duration {
+	u := proxy.routeUpstream()
+	return overrideOr(durationOrSeconds(u.ReadTimeout, u.ReadTimeoutSeconds),
+		proxy.runtime().Connection.Upstream.readTimeoutDuration())
+}
+
+func (proxy *Proxy) upstreamIdleTimeout() time.Duration {
+	u := proxy.routeUpstream()
+	return overrideOr(durationOrSeconds(u.IdleTimeout, u.IdleTimeoutSeconds),
+		proxy.runtime().Connection.Upstream.idleTimeoutDuration())
+}
+
+// upstreamHTTPClient is the user agent for upstream requests. Routes that override the upstream idleTimeout
+// keep their idle connections in a separate pool.
+func (proxy *Proxy) upstreamHTTPClient() HTTPClient {
+	upstream := proxy.runtime().Connection.Upstream
+	if idleTimeout := proxy.upstreamIdleTimeout(); idleTimeout != upstream.idleTimeoutDuration() {
+		return routeHTTPClient(upstream, idleTimeout)
+	}
+	return httpClient
+}
+
+func (proxy *Proxy) maxAttempts() int {
+	return overrideOr(proxy.routeUpstream().MaxAttempts, proxy.runtime().Connection.Upstream.MaxAttempts)
+}
+
+func (proxy *Proxy) downstreamRoundTripTimeoutDuration() time.Duration {
+	d := proxy.routeDownstream()
+	return overrideOr(durationOrSeconds(d.RoundTripTimeout, d.RoundTripTimeoutSeconds),
+		proxy.runtime().Connection.Downstream.roundTripTimeoutDuration())
+}
+
+func (proxy *Proxy) maxBodyBytes() int64 {
+	return overrideOr(proxy.routeDownstream().MaxBodyBytes, proxy.runtime().Connection.Downstream.MaxBodyBytes)
 }
 
 const connectS = "CONNECT"
@@ -794,6 +1257,116 @@ func (proxy *Proxy) pipeDownstreamResponse() {
 	proxy.Dwn.Resp.Writer.Write(*proxy.Dwn.Resp.Body)
 }
 
+// setStreamContentLengthHeader sets Content-Length for a streamed response where only the first chunk of n bytes
+// has been read. If the final length is unknown the header is removed and the response is sent chunked.
+func (proxy *Proxy) setStreamContentLengthHeader(upstreamResponse *http.Response, n int, eof bool, recode ContentEncoding) {
+	if n == 0 {
+		//nothing to stream, same rules as for buffered responses including HEAD and 204.
+		nobody := make([]byte, 0)
+		proxy.Dwn.Resp.Body = &nobody
+		proxy.setContentLengthHeader()
+		return
+	}
+
+	header := proxy.Dwn.Resp.Writer.Header()
+	if len(recode) == 0 && upstreamResponse.ContentLength > 0 {
+		proxy.Dwn.Resp.ContentLength = upstreamResponse.ContentLength
+		header.Set(contentLength, fmt.Sprintf("%d", proxy.Dwn.Resp.ContentLength))
+	} else if len(recode) == 0 && eof {
+		proxy.Dwn.Resp.ContentLength = int64(n)
+		header.Set(contentLength, fmt.Sprintf("%d", proxy.Dwn.Resp.ContentLength))
+	} else {
+		header.Del(contentLength)
+	}
+}
+
+// countingWriter counts bytes written through to the downstream response writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// streamEncoder is a content encoder that can push partial output to the underlying writer.
+type streamEncoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// pipeDownstreamStream writes the first chunk of n bytes already read into buf together with its read error, then
+// copies the rest of the upstream body downstream, re-encoding on the fly if required. Each chunk is flushed so the
+// user agent receives data as it arrives upstream.
+func (proxy *Proxy) pipeDownstreamStream(body io.Reader, buf []byte, n int, readErr error, recode ContentEncoding) error {
+	cw := &countingWriter{w: proxy.Dwn.Resp.Writer}
+	flusher, _ := proxy.Dwn.Resp.Writer.(http.Flusher)
+
+	var enc streamEncoder
+	switch recode {
+	case EncGzip:
+		g := GzipStream(cw)
+		defer ReleaseGzipStream(g)
+		enc = g
+	case EncBrotli:
+		b := BrotliEncodeStream(cw)
+		defer ReleaseBrotliEncodeStream(b)
+		enc = b
+	}
+
+	var dst io.Writer = cw
+	if enc != nil {
+		dst = enc
+	}
+	flush := func() {
+		if enc != nil {
+			enc.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var err error
+	for {
+		if n > 0 {
+			proxy.Up.Atmpt.respBodyBytes += int64(n)
+			if _, err = dst.Write(buf[:n]); err != nil {
+				break
+			}
+			flush()
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+		n, readErr = body.Read(buf)
+	}
+
+	//a broken stream must not be terminated like a complete one
+	if enc != nil && err == nil {
+		enc.Close()
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	proxy.Dwn.Resp.ContentLength = cw.n
+	return err
+}
+
+// abortCommittedResponse aborts the downstream connection if the upstream attempt failed after the response was
+// committed, so the user agent sees a truncated response instead of a complete one.
+func (proxy *Proxy) abortCommittedResponse() {
+	if proxy.Dwn.Resp.Committed && proxy.Up.Atmpt.err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
 // status Code must be last, no headers may be written after this one.
 func (proxy *Proxy) copyUpstreamStatusCodeHeader() {
 	proxy.respondWith(proxy.Up.Atmpt.StatusCode, "none")
@@ -833,7 +1406,7 @@ func (proxy *Proxy) validateJwt() bool {
 
 	if len(bearer) > 1 {
 		token = bearer[1]
-		routeSec := Runner.Jwt[proxy.Route.Jwt]
+		routeSec := proxy.runtime().Jwt[proxy.Route.Jwt]
 		//this is safe to ignore, it was verified during init of config.
 		alg, _ := jwa.LookupSignatureAlgorithm(routeSec.Alg)
 
@@ -867,6 +1440,9 @@ func (proxy *Proxy) validateJwt() bool {
 		}
 
 		ok = parsed != nil && err == nil
+		if ok {
+			proxy.token = parsed
+		}
 	} else {
 		err = errors.New("jwt bearer token not present")
 	}
@@ -883,7 +1459,7 @@ func (proxy *Proxy) validateJwt() bool {
 
 func (proxy *Proxy) verifyMandatoryJwtClaims(token jwt.Token, ev *zerolog.Event) error {
 	var err error
-	jwtc := Runner.Jwt[proxy.Route.Jwt]
+	jwtc := proxy.runtime().Jwt[proxy.Route.Jwt]
 
 	if jwtc.hasMandatoryClaims() {
 		err = errors.New("failed to match any claims required by route")
@@ -970,7 +1546,7 @@ func (proxy *Proxy) verifyJwtSignature(token string, keySet KeySet, alg jwa.Sign
 
 func (proxy *Proxy) triggerKeyRotationCheck(kid string) {
 	route := proxy.Route
-	routeSec := Runner.Jwt[route.Jwt]
+	routeSec := proxy.runtime().Jwt[route.Jwt]
 	if len(routeSec.JwksUrl) > 0 {
 		//MUST run async since it will block on loading remote JWKS key
 		go routeSec.LoadJwks()
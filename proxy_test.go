@@ -4,15 +4,19 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 	"github.com/rs/zerolog/log"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"regexp"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -518,6 +522,103 @@ func TestParseRequestBodyTooLarge(t *testing.T) {
 	}
 }
 
+func TestParseRequestBodyStreamsNonRepeatableMethod(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = 65535
+
+	body := []byte(`{"key":"value"}`)
+	req, _ := http.NewRequest("POST", "/hello", bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	proxy := Proxy{Route: &Route{StreamRequest: true}}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Dwn.Method = "POST"
+	proxy.parseRequestBody(req)
+
+	if len(proxy.Dwn.Body) > 0 {
+		t.Errorf("streamed request body should not be buffered, got %d bytes", len(proxy.Dwn.Body))
+	}
+	if cl := proxy.bodyContentLength(); cl != int64(len(body)) {
+		t.Errorf("streamed request content-length want %d, got %d", len(body), cl)
+	}
+	got, _ := ioutil.ReadAll(proxy.bodyReader())
+	if !bytes.Equal(got, body) {
+		t.Errorf("streamed request body want %s, got %s", body, got)
+	}
+}
+
+func TestParseRequestBodyStreamTooLarge(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = 16
+
+	//unknown content-length, only discovered while streaming
+	req, _ := http.NewRequest("POST", "/hello", bytes.NewReader(make([]byte, 32)))
+	req.ContentLength = -1
+
+	proxy := Proxy{Route: &Route{StreamRequest: true}}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Dwn.Method = "POST"
+	proxy.parseRequestBody(req)
+
+	if proxy.hasStreamedBodyTooLarge() {
+		t.Error("streamed request body should not be too large before it is read")
+	}
+	ioutil.ReadAll(proxy.bodyReader())
+	if !proxy.hasStreamedBodyTooLarge() {
+		t.Errorf("streamed request body should be too large, max %d", Runner.Connection.Downstream.MaxBodyBytes)
+	}
+}
+
+func TestParseRequestBodySpillsRepeatableMethod(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = 1 << 20
+
+	body := bytes.Repeat([]byte("j8a"), spillThresholdBytes)
+	req, _ := http.NewRequest("PUT", "/hello", bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	proxy := Proxy{Route: &Route{StreamRequest: true}}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Dwn.Method = "PUT"
+	proxy.parseRequestBody(req)
+
+	if proxy.Dwn.bodySpill == nil {
+		t.Fatalf("request body of %d bytes should spill to temp file", len(body))
+	}
+	name := proxy.Dwn.bodySpill.Name()
+
+	//every upstream attempt replays the full body
+	for i := 1; i <= 2; i++ {
+		got, _ := ioutil.ReadAll(proxy.bodyReader())
+		if !bytes.Equal(got, body) {
+			t.Errorf("attempt %d spilled request body want %d bytes, got %d", i, len(body), len(got))
+		}
+	}
+
+	proxy.releaseRequestBody()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spilled request body temp file %s should be removed", name)
+	}
+}
+
+func TestParseRequestBodySpillTooLarge(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = spillThresholdBytes * 2
+
+	req, _ := http.NewRequest("PUT", "/hello", bytes.NewReader(make([]byte, spillThresholdBytes*3)))
+	req.ContentLength = -1
+
+	proxy := Proxy{Route: &Route{StreamRequest: true}}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Dwn.Method = "PUT"
+	proxy.parseRequestBody(req)
+	defer proxy.releaseRequestBody()
+
+	if !proxy.Dwn.ReqTooLarge {
+		t.Errorf("spilled request body should be too large, max %d", Runner.Connection.Downstream.MaxBodyBytes)
+	}
+}
+
 func TestSuccessParseUpstreamContentLength(t *testing.T) {
 	upBody := []byte("body")
 	proxy := mockProxy(upBody, fmt.Sprint(len(upBody)), "", "", "", "", "")
@@ -1043,3 +1144,220 @@ func mockProxy(upBody []byte, cl string, path string, transform string, requestU
 
 	return proxy
 }
+
+func TestRetryBackoffIsBoundedByMax(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Upstream.RetryBackoffBase = durationOf(100 * time.Millisecond)
+	Runner.Connection.Upstream.RetryBackoffMax = durationOf(400 * time.Millisecond)
+
+	proxy := Proxy{}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Up.Atmpt = &Atmpt{Count: 10}
+	for i := 0; i < 100; i++ {
+		if got := proxy.retryBackoff(); got < 0 || got > 400*time.Millisecond {
+			t.Errorf("retry backoff should be within [0, 400ms], got %v", got)
+		}
+	}
+}
+
+func TestRetryBackoffIsBoundedByDownstreamRoundTrip(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.RoundTripTimeoutSeconds = 1
+	Runner.Connection.Upstream.RetryBackoffBase = durationOf(10 * time.Second)
+	Runner.Connection.Upstream.RetryBackoffMax = durationOf(10 * time.Second)
+
+	proxy := Proxy{}
+	proxy.Dwn.startDate = time.Now().Add(-900 * time.Millisecond)
+	proxy.Up.Atmpt = &Atmpt{Count: 1}
+	if got := proxy.retryBackoff(); got > 100*time.Millisecond {
+		t.Errorf("retry backoff should not exceed downstream round trip, got %v", got)
+	}
+}
+
+func TestBackoffInterruptedByDownstreamTimeout(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Upstream.RetryBackoffBase = durationOf(10 * time.Second)
+	Runner.Connection.Upstream.RetryBackoffMax = durationOf(10 * time.Second)
+
+	timeout := make(chan struct{})
+	close(timeout)
+	proxy := Proxy{}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Dwn.Timeout = timeout
+	proxy.Up.Atmpt = &Atmpt{Count: 1}
+
+	if proxy.backoff() {
+		t.Error("backoff should not allow retry after downstream timeout")
+	}
+	if !proxy.Dwn.TimeoutFlag {
+		t.Error("backoff should flag downstream timeout")
+	}
+}
+
+func TestBackoffWithoutRetryBackoffRetriesImmediately(t *testing.T) {
+	Runner = mockRuntime()
+	proxy := Proxy{}
+	proxy.Dwn.startDate = time.Now()
+	proxy.Up.Atmpt = &Atmpt{Count: 1}
+
+	start := time.Now()
+	if !proxy.backoff() {
+		t.Error("backoff should allow retry")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("retry without backoff should not wait, took %v", elapsed)
+	}
+}
+
+func TestAtmptPrint(t *testing.T) {
+	atmpt := Atmpt{Count: 2, URL: &URL{Scheme: "http", Host: "localhost", Port: "8080"}, maxAttempts: 3}
+
+	want := "2/3"
+	if got := atmpt.print(); got != want {
+		t.Errorf("attempt print want %s, got %s", want, got)
+	}
+}
+
+func TestUpstreamErrorClass(t *testing.T) {
+	var tests = []struct {
+		n     string
+		err   error
+		class string
+	}{
+		{"no error", nil, emptyString},
+		{"connect refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, connectRefused},
+		{"hangup", io.ErrUnexpectedEOF, upstreamHangupS},
+		{"connection reset", syscall.ECONNRESET, upstreamHangupS},
+		{"timeout", context.DeadlineExceeded, readTimeout},
+		{"other", errors.New("tls: bad certificate"), otherUpstreamError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			proxy := Proxy{}
+			proxy.Up.Atmpt = &Atmpt{err: tt.err}
+			if got := proxy.upstreamErrorClass(); got != tt.class {
+				t.Errorf("error class want %s, got %s", tt.class, got)
+			}
+		})
+	}
+}
+
+func TestRetryableMethodWithIdempotencyKey(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/hello", nil)
+	proxy := Proxy{Route: &Route{Retry: &Retry{IdempotencyKey: true}}}
+	proxy.Dwn.Method = "POST"
+	proxy.Dwn.Req = req
+	proxy.Up.Atmpt = &Atmpt{}
+
+	if proxy.hasRetryableMethod() {
+		t.Error("POST without Idempotency-Key should not be retryable")
+	}
+	req.Header.Set(idempotencyKey, "8e03978e-40d5-43e8-bc93-6894a57f9324")
+	if !proxy.hasRetryableMethod() {
+		t.Error("POST with Idempotency-Key should be retryable")
+	}
+}
+
+func TestRetryableUpstreamErrorClasses(t *testing.T) {
+	proxy := Proxy{Route: &Route{Retry: &Retry{Errors: []string{connectRefused}}}}
+	proxy.Up.Atmpt = &Atmpt{err: io.EOF}
+	if proxy.hasRetryableUpstreamError() {
+		t.Error("upstream hangup should not be retryable")
+	}
+	proxy.Up.Atmpt.err = syscall.ECONNREFUSED
+	if !proxy.hasRetryableUpstreamError() {
+		t.Error("connect refused should be retryable")
+	}
+}
+
+func TestRouteOverridesConnectionParams(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = 1024
+	proxy := Proxy{rt: Runner}
+
+	if proxy.upstreamReadTimeout() != time.Second*120 || proxy.maxAttempts() != 3 || proxy.maxBodyBytes() != 1024 {
+		t.Errorf("proxy without route should use connection params")
+	}
+
+	proxy.Route = &Route{
+		Upstream:   &RouteUpstream{SocketTimeoutSeconds: 1, ReadTimeoutSeconds: 300, IdleTimeoutSeconds: 5, MaxAttempts: 1},
+		Downstream: &RouteDownstream{RoundTripTimeoutSeconds: 360, MaxBodyBytes: 8},
+	}
+	if got := proxy.upstreamSocketTimeout(); got != time.Second {
+		t.Errorf("want socket timeout 1s, got %v", got)
+	}
+	if got := proxy.upstreamReadTimeout(); got != time.Second*300 {
+		t.Errorf("want read timeout 300s, got %v", got)
+	}
+	if got := proxy.upstreamIdleTimeout(); got != time.Second*5 {
+		t.Errorf("want idle timeout 5s, got %v", got)
+	}
+	if got := proxy.maxAttempts(); got != 1 {
+		t.Errorf("want max attempts 1, got %d", got)
+	}
+	if got := proxy.downstreamRoundTripTimeoutDuration(); got != time.Second*360 {
+		t.Errorf("want round trip timeout 360s, got %v", got)
+	}
+	if got := proxy.maxBodyBytes(); got != 8 {
+		t.Errorf("want max body bytes 8, got %d", got)
+	}
+
+	proxy.Route = &Route{Upstream: &RouteUpstream{ReadTimeout: Duration(time.Millisecond * 250)}}
+	if got := proxy.upstreamReadTimeout(); got != time.Millisecond*250 {
+		t.Errorf("want read timeout 250ms, got %v", got)
+	}
+	if proxy.upstreamSocketTimeout() != time.Second*3 || proxy.maxAttempts() != 3 {
+		t.Errorf("zero route overrides should use connection params")
+	}
+}
+
+func TestUpstreamHTTPClientForRouteIdleTimeout(t *testing.T) {
+	Runner = mockRuntime()
+	proxy := Proxy{rt: Runner}
+	if proxy.upstreamHTTPClient() != httpClient {
+		t.Errorf("proxy without route idleTimeout should use the shared http client")
+	}
+
+	proxy.Route = &Route{Upstream: &RouteUpstream{IdleTimeout: Duration(time.Second * 5)}}
+	client, ok := proxy.upstreamHTTPClient().(*http.Client)
+	if !ok || client == httpClient {
+		t.Fatalf("route idleTimeout should use its own http client, got %v", client)
+	}
+	if got := client.Transport.(*http.Transport).IdleConnTimeout; got != time.Second*5 {
+		t.Errorf("want idle conn timeout 5s, got %v", got)
+	}
+	if proxy.upstreamHTTPClient() != client {
+		t.Errorf("routes with the same idleTimeout should share their http client")
+	}
+}
+
+func TestSetRouteRearmsDownstreamTimeout(t *testing.T) {
+	Runner = mockRuntime()
+	req := httptest.NewRequest("GET", "/report", nil)
+	proxy := new(Proxy).
+		setOutgoing(httptest.NewRecorder()).
+		parseIncomingHeaders(req)
+
+	proxy.setRoute(&Route{Path: "/report", Downstream: &RouteDownstream{RoundTripTimeoutSeconds: 1}})
+	select {
+	case <-proxy.Dwn.Timeout:
+	case <-time.After(time.Second * 3):
+		t.Errorf("route round trip timeout should have fired")
+	}
+}
+
+func TestParseRequestBodyHonoursRouteMaxBodyBytes(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Connection.Downstream.MaxBodyBytes = 1 << 20
+	req := httptest.NewRequest("POST", "/report", bytes.NewBufferString("larger than route limit"))
+	proxy := new(Proxy).
+		setOutgoing(httptest.NewRecorder()).
+		parseIncomingHeaders(req)
+	proxy.setRoute(&Route{Path: "/report", Downstream: &RouteDownstream{MaxBodyBytes: 8}})
+	proxy.parseRequestBody(req)
+
+	if !proxy.Dwn.ReqTooLarge {
+		t.Errorf("request body should exceed route max body bytes")
+	}
+}
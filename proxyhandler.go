@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -22,6 +23,14 @@ const acceptEncoding = "Accept-Encoding"
 const contentLength = "Content-Length"
 const date = "Date"
 const server = "Server"
+const keepAliveS = "Keep-Alive"
+const proxyAuthenticate = "Proxy-Authenticate"
+const proxyAuthorization = "Proxy-Authorization"
+const proxyConnection = "Proxy-Connection"
+const te = "Te"
+const trailer = "Trailer"
+const upgrade = "Upgrade"
+const via = "Via"
 
 // httpClient is the global user agent for upstream requests
 var httpClient HTTPClient
@@ -30,11 +39,15 @@ var httpClient HTTPClient
 // server or are ignored.
 var httpHeadersNoRewrite []string = []string{connectionS, date, contentLength, acceptEncoding, transferEncoding, server, varyS}
 
+// httpHopByHopHeaders apply to a single connection and are not copied in either direction, see RFC7230 section 6.1.
+// headers named in the Connection header are hop-by-hop too.
+var httpHopByHopHeaders []string = []string{connectionS, keepAliveS, proxyAuthenticate, proxyAuthorization, proxyConnection, te, trailer, transferEncoding, upgrade}
+
 // extract IPs for stdout. thread safe.
 var ipr iprex = iprex{}
 
 func httpHandler(response http.ResponseWriter, request *http.Request) {
-	proxyHandler(response, request, handleHTTP)
+	proxyHandler(response, request, withConcurrencyLimit(handleHTTP))
 }
 
 const badOrMalFormedRequest = "bad or malformed request"
@@ -57,12 +70,28 @@ func proxyHandler(response http.ResponseWriter, request *http.Request, exec prox
 	//preprocess incoming request in proxy object
 	proxy := new(Proxy).
 		setOutgoing(response).
-		parseIncoming(request)
+		parseIncomingHeaders(request)
+
+	//the route decides if the body is buffered or streamed upstream, so match it before reading the body
+	matchSpan := proxy.startSpan(routeMatchSpan, spanKindInternal)
+	matched := matchRoutes(request, proxy)
+	if matched {
+		matchSpan.setStr("http.route", proxy.Route.Path)
+	}
+	matchSpan.finish()
+
+	//denied clients are rejected before their request body is read and before jwt validation
+	if !proxy.isClientAllowed() {
+		sendStatusCodeAsJSON(proxy.respondWith(403, clientIPForbidden))
+		return
+	}
+	proxy.parseRequestBody(request)
+	defer proxy.releaseRequestBody()
 
 	//all malformed requests are rejected here and we return a 400
 	if !validate(proxy) {
 		if proxy.Dwn.ReqTooLarge {
-			sendStatusCodeAsJSON(proxy.respondWith(413, fmt.Sprintf(httpRequestEntityTooLarge, Runner.Connection.Downstream.MaxBodyBytes)))
+			sendStatusCodeAsJSON(proxy.respondWith(413, fmt.Sprintf(httpRequestEntityTooLarge, proxy.maxBodyBytes())))
 		} else if !proxy.Dwn.AcceptEncoding.hasAtLeastOneValidEncoding() {
 			sendStatusCodeAsJSON(proxy.respondWith(406, formatInvalidAcceptEncoding()))
 		} else {
@@ -82,9 +111,27 @@ func proxyHandler(response http.ResponseWriter, request *http.Request, exec prox
 		return
 	}
 
-	if matchRoutes(request, proxy) {
-		if proxy.Route.hasJwt() && !proxy.validateJwt() {
-			sendStatusCodeAsJSON(proxy.respondWith(401, jwtBearerTokenMissing))
+	if matched {
+		if proxy.Route.hasJwt() {
+			jwtSpan := proxy.startSpan(jwtValidationSpan, spanKindInternal).
+				setStr("j8a.jwt", proxy.Route.Jwt)
+			valid := proxy.validateJwt()
+			if !valid {
+				jwtSpan.setError(jwtBearerTokenMissing)
+			}
+			jwtSpan.finish()
+			if !valid {
+				proxy.observeJwtReject()
+				sendStatusCodeAsJSON(proxy.respondWith(401, jwtBearerTokenMissing))
+				return
+			}
+		}
+		//rate limits run after jwt validation so they can be keyed by claim
+		if proxy.Route.hasRateLimit() {
+			if res := proxy.takeRateLimit(); !res.Allowed {
+				rateLimited(proxy, res)
+				return
+			}
 		}
 		url, label, mapped := proxy.Route.mapURL(proxy)
 		if mapped {
@@ -99,17 +146,13 @@ func proxyHandler(response http.ResponseWriter, request *http.Request, exec prox
 	}
 }
 
-// TODO this needs a new order. Exact matches first, then prefix matches. inside all these, longer matches first, then shorter ones.
-// try a custom sorter for routes.
+// matchRoutes sets the first route in sort order that matches the request.
 func matchRoutes(request *http.Request, proxy *Proxy) bool {
-	matched := false
-	for _, route := range Runner.Routes {
-		if matched = route.match(request); matched {
-			proxy.setRoute(&route)
-			break
-		}
+	if route := proxy.runtime().routeMatcher.match(request); route != nil {
+		proxy.setRoute(route)
+		return true
 	}
-	return matched
+	return false
 }
 
 func validate(proxy *Proxy) bool {
@@ -122,20 +165,34 @@ const connectionClosedByRemoteUserAgent = "downstream remote user agent aborted
 const gatewayTimeoutTriggeredByDownstreamEvent = "gateway timeout triggered by downstream timeout"
 const gatewayTimeoutTriggeredByUpstreamEvent = "gateway timeout triggered by upstream attempt"
 const badGatewayTriggeredUnableToProcessUpstreamResponse = "bad gateway triggered. unable to process upstream response"
+const upstreamCircuitBreakerOpen = "upstream circuit breaker open"
 
 func handleHTTP(proxy *Proxy) {
+	//open circuit breakers fail fast instead of waiting for the upstream to time out
+	if !proxy.admitUpstreamAttempt() {
+		sendStatusCodeAsJSON(proxy.respondWith(503, upstreamCircuitBreakerOpen))
+		return
+	}
+
+	release := outstandingRequests.begin(*proxy.Up.Atmpt.URL)
 	upstreamResponse, upstreamError := performUpstreamRequest(proxy)
 	if upstreamResponse != nil && upstreamResponse.Body != nil {
 		defer upstreamResponse.Body.Close()
 	}
 
-	if !processUpstreamResponse(proxy, upstreamResponse, upstreamError) {
-		if proxy.shouldRetryUpstreamAttempt() {
+	processed := processUpstreamResponse(proxy, upstreamResponse, upstreamError)
+	release()
+	proxy.runtime().CircuitBreakers.record(*proxy.Up.Atmpt.URL, proxy.attemptOutcome())
+	proxy.abortCommittedResponse()
+	if !processed {
+		if proxy.shouldRetryUpstreamAttempt() && proxy.backoff() {
 			handleHTTP(proxy.nextAttempt())
 		} else {
 			//sends 504 for downstream timeout, 504 for upstream timeout, 499 for downstream remote hangup,
 			//502 in all other cases
-			if proxy.Dwn.TimeoutFlag == true {
+			if proxy.hasStreamedBodyTooLarge() {
+				sendStatusCodeAsJSON(proxy.respondWith(413, fmt.Sprintf(httpRequestEntityTooLarge, proxy.maxBodyBytes())))
+			} else if proxy.Dwn.TimeoutFlag == true {
 				sendStatusCodeAsJSON(proxy.respondWith(504, gatewayTimeoutTriggeredByDownstreamEvent))
 			} else if proxy.Dwn.AbortedFlag == true {
 				sendStatusCodeAsJSON(proxy.respondWith(499, connectionClosedByRemoteUserAgent))
@@ -159,16 +216,22 @@ func scaffoldUpstreamRequest(proxy *Proxy) *http.Request {
 	proxy.Up.Atmpt.CancelFunc = cancel
 
 	//will call the cancel func in it's own goroutine after timeout seconds.
-	time.AfterFunc(time.Duration(Runner.Connection.Upstream.ReadTimeoutSeconds)*time.Second, func() {
+	time.AfterFunc(proxy.upstreamReadTimeout(), func() {
 		cancel()
 	})
 
+	//the route may override the socket timeout of the shared http client
+	ctx = context.WithValue(ctx, upstreamSocketTimeoutKey{}, proxy.upstreamSocketTimeout())
+
 	upURI := proxy.resolveUpstreamURI()
 
 	upstreamRequest, _ := http.NewRequestWithContext(ctx,
 		proxy.Dwn.Method,
 		upURI,
 		proxy.bodyReader())
+	if cl := proxy.bodyContentLength(); cl > 0 {
+		upstreamRequest.ContentLength = cl
+	}
 
 	infoOrTraceEv(proxy).Str(dwnReqPath, proxy.Dwn.Path).
 		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
@@ -182,17 +245,25 @@ func scaffoldUpstreamRequest(proxy *Proxy) *http.Request {
 	upstreamRequest.Header.Add(acceptEncoding, proxy.Dwn.AcceptEncoding.Print())
 
 	//set upstream headers
-	for key, values := range proxy.Dwn.Req.Header {
-		if shouldProxyHeader(key) {
-			for _, value := range values {
-				upstreamRequest.Header.Add(key, value)
-			}
-		}
-	}
+	copyHeaders(upstreamRequest.Header, proxy.Dwn.Req.Header)
+	appendHeader(upstreamRequest.Header, via, viaValue(proxy.Dwn.Req.ProtoMajor, proxy.Dwn.Req.ProtoMinor))
 
 	//this is redundant for HTTP/1.1, spec ref: https://datatracker.ietf.org/doc/html/rfc2616#section-8.1.3
 	//upstreamRequest.Header.Set(connectionS, keepAlive)
 	upstreamRequest.Header.Set(XRequestID, proxy.XRequestID)
+	proxy.setForwardedHeaders(upstreamRequest.Header)
+	if proxy.Route.HostHeader == hostHeaderPreserve {
+		upstreamRequest.Host = proxy.Dwn.Req.Host
+	}
+	proxy.Route.RequestHeaders.apply(proxy, upstreamRequest.Header)
+
+	//each attempt is a client span and the parent of the upstream server span
+	proxy.Up.Atmpt.span = proxy.startSpan(upstreamAttemptSpan, spanKindClient).
+		setStr("http.request.method", proxy.Dwn.Method).
+		setStr("url.full", upURI).
+		setStr("j8a.upstream.label", proxy.Up.Atmpt.Label).
+		setInt("j8a.attempt", proxy.Up.Atmpt.Count)
+	proxy.setTraceHeaders(upstreamRequest.Header, proxy.Up.Atmpt.span)
 
 	return upstreamRequest
 }
@@ -230,7 +301,7 @@ func performUpstreamRequest(proxy *Proxy) (*http.Response, error) {
 		}()
 
 		//this blocks until upstream headers come in
-		upstreamResponse, upstreamError = httpClient.Do(req)
+		upstreamResponse, upstreamError = proxy.upstreamHTTPClient().Do(req)
 		proxy.Up.Atmpt.resp = upstreamResponse
 
 		if proxy.Up.Atmpts[attemptIndex].CompleteHeader != nil &&
@@ -251,7 +322,7 @@ func performUpstreamRequest(proxy *Proxy) (*http.Response, error) {
 		//aborts due to timeout don't set upstream error
 		if upstreamError == nil {
 			scaffoldUpAttemptLog(proxy).
-				Int(upReadTimeoutSecs, Runner.Connection.Upstream.ReadTimeoutSeconds).
+				Float64(upReadTimeoutSecs, proxy.upstreamReadTimeout().Seconds()).
 				Msg(upConReadTimeoutFired)
 		} else {
 			scaffoldUpAttemptLog(proxy).
@@ -358,7 +429,7 @@ func parseUpstreamResponse(upstreamResponse *http.Response, proxy *Proxy) ([]byt
 		proxy.Up.Atmpt.AbortedFlag = true
 		if bodyError == nil {
 			scaffoldUpAttemptLog(proxy).
-				Int(upReadTimeoutSecs, Runner.Connection.Upstream.ReadTimeoutSeconds).
+				Float64(upReadTimeoutSecs, proxy.upstreamReadTimeout().Seconds()).
 				Msg(upstreamConReadTimeoutFired)
 		} else {
 			scaffoldUpAttemptLog(proxy).
@@ -420,33 +491,169 @@ func parseUpstreamResponse(upstreamResponse *http.Response, proxy *Proxy) ([]byt
 func processUpstreamResponse(proxy *Proxy, upstreamResponse *http.Response, upstreamError error) bool {
 	//process only if we can work with upstream attempt
 	if upstreamResponse != nil && upstreamError == nil && !proxy.hasUpstreamAttemptAborted() {
-		//j8a blocks here when waiting for upstream body
-		upstreamResponseBody, bodyError := parseUpstreamResponse(upstreamResponse, proxy)
-		upstreamError = bodyError
-		proxy.Up.Atmpt.respBody = &upstreamResponseBody
-		if shouldProxyUpstreamResponse(proxy, bodyError) {
-			logSuccessfulUpstreamAttempt(proxy, upstreamResponse)
-			if isUpstreamClientError(proxy) {
-				proxy.copyUpstreamStatusCodeHeader()
-				sendStatusCodeAsJSON(proxy)
-			} else {
-				proxy.writeStandardResponseHeaders()
-				proxy.copyUpstreamResponseHeaders()
-				proxy.copyUpstreamStatusCodeHeader()
-				proxy.encodeUpstreamResponseBody()
-				proxy.setContentLengthHeader()
-				proxy.sendDownstreamStatusCodeHeader()
-				proxy.pipeDownstreamResponse()
-				logHandledDownstreamRoundtrip(proxy)
+		if proxy.shouldStreamUpstreamResponse() {
+			var streamed bool
+			if streamed, upstreamError = streamUpstreamResponse(proxy, upstreamResponse); streamed {
+				return true
+			}
+		} else {
+			//j8a blocks here when waiting for upstream body
+			upstreamResponseBody, bodyError := parseUpstreamResponse(upstreamResponse, proxy)
+			upstreamError = bodyError
+			proxy.Up.Atmpt.respBody = &upstreamResponseBody
+			if shouldProxyUpstreamResponse(proxy, bodyError) {
+				logSuccessfulUpstreamAttempt(proxy, upstreamResponse)
+				if isUpstreamClientError(proxy) {
+					proxy.copyUpstreamStatusCodeHeader()
+					sendStatusCodeAsJSON(proxy)
+				} else {
+					proxy.writeStandardResponseHeaders()
+					proxy.copyUpstreamResponseHeaders()
+					proxy.copyUpstreamStatusCodeHeader()
+					proxy.encodeUpstreamResponseBody()
+					proxy.setContentLengthHeader()
+					proxy.sendDownstreamStatusCodeHeader()
+					proxy.pipeDownstreamResponse()
+					logHandledDownstreamRoundtrip(proxy)
+				}
+				return true
 			}
-			return true
 		}
 	}
 	//now log unsuccessful and retry or exit with status Code.
+	proxy.Up.Atmpt.err = upstreamError
 	logUnsuccessfulUpstreamAttempt(proxy, upstreamResponse, upstreamError)
 	return false
 }
 
+const upstreamResBodyStreamed = "upstream response body streamed"
+const upstreamResBodyStreamAbort = "upstream response body streaming aborted after downstream response was committed, cause: %v"
+const streamBufferBytes = 32 << 10
+
+// streamUpstreamResponse sends the upstream response downstream while the body is still being read. The first chunk
+// is read before anything is committed downstream, so a failing upstream can still be retried up to that point.
+// Returns true once the downstream response was sent.
+func streamUpstreamResponse(proxy *Proxy, upstreamResponse *http.Response) (bool, error) {
+	proxy.Up.Atmpt.StatusCode = upstreamResponse.StatusCode
+	proxy.Up.Atmpt.ContentEncoding = NewContentEncoding(upstreamResponse.Header.Get(contentEncoding))
+
+	if !shouldProxyUpstreamResponse(proxy, nil) {
+		return false, nil
+	}
+
+	if isUpstreamClientError(proxy) {
+		logSuccessfulUpstreamAttempt(proxy, upstreamResponse)
+		proxy.copyUpstreamStatusCodeHeader()
+		sendStatusCodeAsJSON(proxy)
+		return true, nil
+	}
+
+	//downstream timeouts and aborts cancel the upstream body read while we stream.
+	stop := proxy.abortUpstreamStreamOnDownstreamEvent()
+
+	buf := make([]byte, streamBufferBytes)
+	n, readErr := readFirstChunk(upstreamResponse.Body, buf)
+	if n == 0 && readErr != io.EOF {
+		stop()
+		return false, readErr
+	}
+
+	logSuccessfulUpstreamAttempt(proxy, upstreamResponse)
+	proxy.writeStandardResponseHeaders()
+	proxy.copyUpstreamResponseHeaders()
+	proxy.copyUpstreamStatusCodeHeader()
+
+	recode := ContentEncoding(emptyString)
+	if n > 0 {
+		recode = proxy.negotiateDownstreamContentEncoding()
+		proxy.setContentEncodingHeaders()
+	} else {
+		scaffoldUpAttemptLog(proxy).
+			Msg(upstreamResponseNoBody)
+	}
+	proxy.setStreamContentLengthHeader(upstreamResponse, n, readErr == io.EOF, recode)
+	proxy.sendDownstreamStatusCodeHeader()
+	proxy.Dwn.Resp.Committed = true
+
+	var err error
+	if n > 0 {
+		err = proxy.pipeDownstreamStream(upstreamResponse.Body, buf, n, readErr, recode)
+	}
+	stop()
+	if n > 0 {
+		ul := scaffoldUpAttemptLog(proxy)
+		if len(proxy.Up.Atmpt.ContentEncoding) > 0 {
+			ul.Str(upAtmptCntntEnc, proxy.Up.Atmpt.ContentEncoding.print())
+		}
+		ul.Int64(upResBodyBytes, proxy.Up.Atmpt.respBodyBytes)
+		if err != nil {
+			//the handler aborts the downstream connection once the attempt is accounted for
+			proxy.Up.Atmpt.err = err
+			ul.Msgf(upstreamResBodyStreamAbort, err)
+		} else {
+			ul.Msg(upstreamResBodyStreamed)
+		}
+	}
+
+	logHandledDownstreamRoundtrip(proxy)
+	return true, nil
+}
+
+// readFirstChunk blocks until the upstream body delivers at least one byte, an error or EOF.
+func readFirstChunk(body io.Reader, buf []byte) (int, error) {
+	if body == nil {
+		return 0, io.EOF
+	}
+	for {
+		n, err := body.Read(buf)
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// abortUpstreamStreamOnDownstreamEvent cancels the upstream attempt if the downstream times out or aborts while we
+// stream. The returned stop func ends the watch and flags the downstream event on the handler goroutine.
+func (proxy *Proxy) abortUpstreamStreamOnDownstreamEvent() func() {
+	done := make(chan struct{})
+	event := make(chan string, 1)
+	cancel := proxy.Up.Atmpt.CancelFunc
+	go func() {
+		defer close(event)
+		select {
+		case <-proxy.Dwn.Timeout:
+			event <- downstreamRtFired
+		case <-proxy.Dwn.Aborted:
+			event <- downstreamReqAborted
+		case <-done:
+			return
+		}
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	return func() {
+		close(done)
+		msg := <-event
+		switch msg {
+		case downstreamRtFired:
+			proxy.Dwn.TimeoutFlag = true
+		case downstreamReqAborted:
+			proxy.Dwn.AbortedFlag = true
+		default:
+			return
+		}
+		scaffoldUpAttemptLog(proxy).
+			Msg(msg)
+		proxy.abortAllUpstreamAttempts()
+	}
+}
+
+func (proxy *Proxy) shouldStreamUpstreamResponse() bool {
+	return proxy.Route != nil && proxy.Route.StreamResponse
+}
+
 func isUpstreamClientError(proxy *Proxy) bool {
 	return proxy.Up.Atmpt.StatusCode > 399 && proxy.Up.Atmpt.StatusCode < 500
 }
@@ -455,7 +662,7 @@ func shouldProxyUpstreamResponse(proxy *Proxy, bodyError error) bool {
 	return !proxy.hasDownstreamAbortedOrTimedout() &&
 		!proxy.hasUpstreamAttemptAborted() &&
 		bodyError == nil &&
-		proxy.Up.Atmpt.resp.StatusCode < 500
+		!proxy.routeRetry().retriesStatusCode(proxy.Up.Atmpt.resp.StatusCode)
 }
 
 func shouldProxyHeader(header string) bool {
@@ -464,15 +671,60 @@ func shouldProxyHeader(header string) bool {
 			return false
 		}
 	}
+	for _, hop := range httpHopByHopHeaders {
+		if strings.EqualFold(header, hop) {
+			return false
+		}
+	}
 	return true
 }
 
+// copyHeaders adds the end-to-end headers of src to dst.
+func copyHeaders(dst http.Header, src http.Header) {
+	hops := connectionTokens(src)
+	for key, values := range src {
+		if shouldProxyHeader(key) && !hops[http.CanonicalHeaderKey(key)] {
+			for _, value := range values {
+				dst.Add(key, value)
+			}
+		}
+	}
+}
+
+// connectionTokens are the header names listed in the Connection header.
+func connectionTokens(h http.Header) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, v := range h.Values(connectionS) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); len(t) > 0 {
+				tokens[http.CanonicalHeaderKey(t)] = true
+			}
+		}
+	}
+	return tokens
+}
+
+// viaValue is the Via entry of this hop for the received protocol version, i.e. "1.1 j8a" or "2 j8a".
+func viaValue(protoMajor int, protoMinor int) string {
+	switch {
+	case protoMajor == 0:
+		return HTTP11 + " " + j8a
+	case protoMajor >= 2:
+		return fmt.Sprintf("%d %s", protoMajor, j8a)
+	}
+	return fmt.Sprintf("%d.%d %s", protoMajor, protoMinor, j8a)
+}
+
 func scaffoldUpAttemptLog(proxy *Proxy) *zerolog.Event {
-	return infoOrTraceEv(proxy).
+	ev := proxy.withTrace(infoOrTraceEv(proxy)).
 		Str(XRequestID, proxy.XRequestID).
 		Int64(upAtmtpElpsdMicros, time.Since(proxy.Up.Atmpt.startDate).Microseconds()).
 		Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
 		Str(upAtmpt, proxy.Up.Atmpt.print())
+	if proxy.Up.Atmpt.URL != nil {
+		ev = ev.Str(upResource, proxy.Up.Atmpt.URL.String())
+	}
+	return ev
 }
 
 const downstreamResponseServed = "downstream HTTP response served"
@@ -489,10 +741,11 @@ func logHandledDownstreamRoundtrip(proxy *Proxy) {
 		ev = ev.Str(upReqURI, proxy.resolveUpstreamURI()).
 			Str(upLabel, proxy.Up.Atmpt.Label).
 			Int(upAtmptResCode, proxy.Up.Atmpt.StatusCode).
-			Int(upAtmptResBodyBytes, len(*proxy.Up.Atmpt.respBody)).
+			Int(upAtmptResBodyBytes, proxy.Up.Atmpt.respBodyLen()).
 			Int64(upAtmptElpsdMicros, time.Since(proxy.Up.Atmpt.startDate).Microseconds()).
 			Bool(upAtmptAbort, proxy.Up.Atmpt.AbortedFlag).
-			Str(upAtmpt, proxy.Up.Atmpt.print())
+			Str(upAtmpt, proxy.Up.Atmpt.print()).
+			Str(upResource, proxy.Up.Atmpt.URL.String())
 	}
 
 	if proxy.Dwn.Resp.StatusCode > 399 {
@@ -520,11 +773,13 @@ func logHandledDownstreamRoundtrip(proxy *Proxy) {
 		ev = ev.Str(dwnResCntntEnc, string(proxy.Dwn.Resp.ContentEncoding))
 	}
 
-	if Runner.isTLSOn() {
+	if proxy.runtime().isTLSOn() {
 		ev = ev.Str(dwnReqTlsVer, proxy.Dwn.TlsVer)
 	}
 
-	ev.Msg(msg)
+	proxy.withTrace(ev).Msg(msg)
+	proxy.observeDownstreamRoundtrip(elapsed)
+	proxy.finishTrace()
 }
 
 const upstreamAttemptSuccessful = "upstream attempt successful"
@@ -534,6 +789,9 @@ func logSuccessfulUpstreamAttempt(proxy *Proxy, upstreamResponse *http.Response)
 	scaffoldUpAttemptLog(proxy).
 		Int(upAtmptResCode, upstreamResponse.StatusCode).
 		Msg(upstreamAttemptSuccessful)
+	proxy.recordOutlierOutcome()
+	proxy.observeUpstreamAttempt()
+	proxy.Up.Atmpt.span.setInt("http.response.status_code", upstreamResponse.StatusCode).finish()
 }
 
 const undeterminedUpstreamError = "undetermined but raw error was: %v"
@@ -541,6 +799,9 @@ const upstreamHangup = "upstream TCP socket hung up on us remotely"
 const eofS = "EOF"
 
 func logUnsuccessfulUpstreamAttempt(proxy *Proxy, upstreamResponse *http.Response, upstreamError error) {
+	proxy.recordOutlierOutcome()
+	proxy.observeUpstreamAttempt()
+	proxy.finishUnsuccessfulAttemptSpan(upstreamResponse, upstreamError)
 	ev := scaffoldUpAttemptLog(proxy)
 	if upstreamResponse != nil && upstreamResponse.StatusCode > 0 {
 		ev = ev.Int(upAtmptResCode, upstreamResponse.StatusCode)
@@ -2,12 +2,17 @@ package j8a
 
 import (
 	"bytes"
+	"errors"
 	"github.com/rs/zerolog"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -562,6 +567,169 @@ func TestUpstreamGETRetry(t *testing.T) {
 	}
 }
 
+// mocks a chunked upstream response that is streamed downstream and re-encoded with gzip on the fly
+func TestUpstreamStreamGzipReEncoding(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].StreamResponse = true
+	httpClient = &MockHttp{}
+	json := `{"key":"value","streamed":true}`
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: -1,
+			Body:          ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader([]byte(json)))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	c := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotBody, _ := ioutil.ReadAll(resp.Body)
+	if got := string(*Gunzip(gotBody)); got != json {
+		t.Errorf("uh oh, streamed body not gzip encoded correctly, want %v, got %v", json, got)
+	}
+	if got := resp.Header.Get(contentEncoding); got != "gzip" {
+		t.Errorf("uh oh, did not receive correct Content-Encoding header, want gzip, got %v", got)
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("uh oh, re-encoded stream should not declare content length, got %v", resp.ContentLength)
+	}
+}
+
+// mocks an identity upstream response with known length that is streamed through as is
+func TestUpstreamStreamIdentityPassThrough(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].StreamResponse = true
+	httpClient = &MockHttp{}
+	json := `{"key":"value"}`
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    201,
+			ContentLength: int64(len(json)),
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(json))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(acceptEncoding, "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotBody, _ := ioutil.ReadAll(resp.Body)
+	if string(gotBody) != json {
+		t.Errorf("uh oh, streamed body not passed through, want %v, got %v", json, string(gotBody))
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("uh oh, received incorrect status Code from streaming proxyhandler, want 201, got %v", resp.StatusCode)
+	}
+	if resp.ContentLength != int64(len(json)) {
+		t.Errorf("uh oh, streamed identity body should keep upstream content length, want %v, got %v", len(json), resp.ContentLength)
+	}
+}
+
+// upstream body fails before the first byte, so j8a can still retry and finally sends a 502
+func TestUpstreamStreamRetryBeforeFirstByte(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].StreamResponse = true
+	httpClient = &MockHttp{}
+	attempts := 0
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: -1,
+			Body:          ioutil.NopCloser(iotest.ErrReader(errors.New("upstream hung up"))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 502 {
+		t.Errorf("uh oh, received incorrect status Code from retrying streaming proxyhandler, want 502, got %v", resp.StatusCode)
+	}
+	if attempts != Runner.Connection.Upstream.MaxAttempts {
+		t.Errorf("uh oh, streaming proxyhandler did not retry before first byte, want %d attempts, got %d", Runner.Connection.Upstream.MaxAttempts, attempts)
+	}
+}
+
+// upstream body fails after the first byte was committed downstream, no more retries are possible.
+func TestUpstreamStreamNoRetryAfterFirstByte(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].StreamResponse = true
+	httpClient = &MockHttp{}
+	attempts := 0
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: -1,
+			Body:          ioutil.NopCloser(iotest.DataErrReader(iotest.TimeoutReader(bytes.NewReader([]byte("partial response body"))))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(acceptEncoding, "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 {
+		t.Errorf("uh oh, committed streaming response should keep upstream status Code, want 200, got %v", resp.StatusCode)
+	}
+	if err == nil {
+		t.Errorf("uh oh, broken upstream stream should abort the downstream response, but body was read without error")
+	}
+	if attempts != 1 {
+		t.Errorf("uh oh, streaming proxyhandler retried after first byte was committed, got %d attempts", attempts)
+	}
+}
+
+func TestAbortUpstreamStreamOnDownstreamTimeout(t *testing.T) {
+	Runner = mockRuntime()
+	timeout := make(chan struct{})
+	cancelled := make(chan struct{}, 2)
+	proxy := &Proxy{}
+	proxy.Dwn.Timeout = timeout
+	proxy.Up.Atmpts = []Atmpt{{CancelFunc: func() { cancelled <- struct{}{} }}}
+	proxy.Up.Atmpt = &proxy.Up.Atmpts[0]
+
+	stop := proxy.abortUpstreamStreamOnDownstreamEvent()
+	close(timeout)
+	<-cancelled
+	stop()
+
+	if !proxy.Dwn.TimeoutFlag {
+		t.Errorf("downstream timeout during stream should be flagged")
+	}
+	if len(cancelled) != 1 {
+		t.Errorf("upstream attempts should be aborted on the handler goroutine after stop")
+	}
+}
+
 func TestProxyHeaderRewrite(t *testing.T) {
 	cl := "conTenT-LEngtH"
 	if shouldProxyHeader(cl) {
@@ -569,6 +737,85 @@ func TestProxyHeaderRewrite(t *testing.T) {
 	}
 }
 
+func TestCopyHeadersStripsHopByHop(t *testing.T) {
+	src := http.Header{}
+	src.Set("Connection", "keep-alive, X-Hop")
+	src.Set("Keep-Alive", "timeout=5")
+	src.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	src.Set("Te", "trailers")
+	src.Set("Trailer", "X-Checksum")
+	src.Set("Upgrade", "h2c")
+	src.Set("X-Hop", "1")
+	src.Set("X-End", "1")
+
+	dst := http.Header{}
+	copyHeaders(dst, src)
+	if len(dst) != 1 || dst.Get("X-End") != "1" {
+		t.Errorf("only end-to-end headers should be copied, got %v", dst)
+	}
+}
+
+func TestViaValue(t *testing.T) {
+	var tests = []struct {
+		major int
+		minor int
+		want  string
+	}{
+		{1, 0, "1.0 j8a"},
+		{1, 1, "1.1 j8a"},
+		{2, 0, "2 j8a"},
+		{0, 0, "1.1 j8a"},
+	}
+	for _, tt := range tests {
+		if got := viaValue(tt.major, tt.minor); got != tt.want {
+			t.Errorf("want Via %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestUpstreamResponseHopByHopHeadersStripped(t *testing.T) {
+	Runner = mockRuntime()
+	httpClient = &MockHttp{}
+	var upHeader http.Header
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		upHeader = req.Header
+		h := http.Header{}
+		h.Set("Connection", "X-Hop")
+		h.Set("X-Hop", "1")
+		h.Set("Proxy-Authenticate", "Basic")
+		h.Set("Via", "1.1 upstream")
+		return &http.Response{
+			StatusCode: 200,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     h,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Connection", "X-Secret")
+	req.Header.Set("X-Secret", "1")
+	req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	if len(upHeader.Get("X-Secret")) > 0 || len(upHeader.Get("Proxy-Authorization")) > 0 {
+		t.Errorf("hop-by-hop headers should not be sent upstream, got %v", upHeader)
+	}
+	if got := upHeader.Get("Via"); got != "1.1 j8a" {
+		t.Errorf("want upstream Via 1.1 j8a, got %s", got)
+	}
+	if len(resp.Header.Get("X-Hop")) > 0 || len(resp.Header.Get("Proxy-Authenticate")) > 0 {
+		t.Errorf("hop-by-hop headers should not be sent downstream, got %v", resp.Header)
+	}
+	if got := resp.Header.Get("Via"); got != "1.1 upstream, 1.1 j8a" {
+		t.Errorf("want downstream Via appended, got %s", got)
+	}
+}
+
 func TestJsonifyUpstreamHeadersWithEmptyUp(t *testing.T) {
 	res := jsonifyUpstreamHeaders(&Proxy{
 		Up: Up{},
@@ -679,6 +926,103 @@ func mockRunner() {
 	Runner = mockRuntime()
 }
 
+func TestUpstreamNonRetryableStatusCodePassedThrough(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].Retry = &Retry{StatusCodes: []int{502, 503, 504}}
+	httpClient = &MockHttp{}
+	attempts := 0
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode: 500,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"key":"value"}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 500 {
+		t.Errorf("non retryable upstream status should be passed downstream, want 500, got %d", resp.StatusCode)
+	}
+	if attempts != 1 {
+		t.Errorf("non retryable upstream status should not be retried, want 1 attempt, got %d", attempts)
+	}
+}
+
+func TestUpstreamRetryableStatusCodeRetried(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Routes[0].Retry = &Retry{StatusCodes: []int{503}}
+	httpClient = &MockHttp{}
+	attempts := 0
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode: 503,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"key":"value"}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 502 {
+		t.Errorf("exhausted retries should send 502, got %d", resp.StatusCode)
+	}
+	if attempts != Runner.Connection.Upstream.MaxAttempts {
+		t.Errorf("retryable upstream status should be retried, want %d attempts, got %d", Runner.Connection.Upstream.MaxAttempts, attempts)
+	}
+}
+
+func TestUpstreamNonIdempotentRetriedWhenNotSent(t *testing.T) {
+	var tests = []struct {
+		n        string
+		retry    *Retry
+		err      error
+		attempts int
+	}{
+		{"no retry block", nil, syscall.ECONNREFUSED, 1},
+		{"connect refused", &Retry{NonIdempotent: true}, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, 3},
+		{"upstream hangup", &Retry{NonIdempotent: true}, io.ErrUnexpectedEOF, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			Runner = mockRuntime()
+			Runner.Connection.Downstream.MaxBodyBytes = 65535
+			Runner.Routes[0].Retry = tt.retry
+			httpClient = &MockHttp{}
+			attempts := 0
+			mockDoFunc = func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return nil, tt.err
+			}
+
+			server := httptest.NewServer(&ProxyHttpHandler{})
+			defer server.Close()
+
+			resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(`{"key":"value"}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 502 {
+				t.Errorf("failed upstream should send 502, got %d", resp.StatusCode)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("want %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
 func mockRuntime() *Runtime {
 	r := &Runtime{
 		Config: Config{
@@ -786,12 +1130,13 @@ func mockRuntime() *Runtime {
 		},
 		Start:             time.Now(),
 		AcmeHandler:       NewAcmeHandler(),
-		ConnectionWatcher: ConnectionWatcher{dwnOpenConns: 0},
+		ConnectionWatcher: &ConnectionWatcher{dwnOpenConns: 0},
 	}
 
 	//simple compiled regexes for prefix matching only
 	r.Routes[0].compilePath()
 	r.Routes[1].compilePath()
+	r.routeMatcher = NewRouteMatcher(r.Routes)
 
 	//we need this to add the reloadable cert.
 	r.initReloadableCert()
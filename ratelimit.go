@@ -0,0 +1,244 @@
+package j8a
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket policy that routes refer to by name. Each route keeps its own buckets.
+type RateLimit struct {
+	Name string
+
+	// Key is what requests are counted by, one of clientIP | header | claim | route. Defaults to clientIP
+	Key string
+
+	// KeyName is the header name for key header, or the jwt claim name for key claim.
+	KeyName string
+
+	// RequestsPerSecond is the rate tokens are refilled at.
+	RequestsPerSecond float64
+
+	// Burst is the bucket size, the number of requests allowed at once. Defaults to RequestsPerSecond rounded up
+	Burst int
+}
+
+const rateLimitKeyClientIP = "clientIP"
+const rateLimitKeyHeader = "header"
+const rateLimitKeyClaim = "claim"
+const rateLimitKeyRoute = "route"
+
+const rateLimitHeaderLimit = "RateLimit-Limit"
+const rateLimitHeaderRemaining = "RateLimit-Remaining"
+const rateLimitHeaderReset = "RateLimit-Reset"
+const retryAfter = "Retry-After"
+
+const rateLimitExceeded = "rate limit exceeded, retry after %d seconds"
+const rateLimitApplied = "downstream request rate limited by %s on key %s"
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the wait until the next token is available.
+	RetryAfter time.Duration
+	// Reset is the wait until the bucket is full again.
+	Reset time.Duration
+}
+
+// RateLimitStore keeps token buckets. The memory store limits per instance, a shared store can implement this
+// to limit across instances.
+type RateLimitStore interface {
+	Take(key string, limit *RateLimit, now time.Time) RateLimitResult
+}
+
+// MemoryRateLimitStore keeps token buckets of this instance in memory.
+type MemoryRateLimitStore struct {
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+const rateLimitSweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// Take removes a token from the bucket for key if there is one.
+func (s *MemoryRateLimitStore) Take(key string, limit *RateLimit, now time.Time) RateLimitResult {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	//limits can change on config reload
+	b.rate, b.burst = limit.RequestsPerSecond, limit.Burst
+	b.refill(now)
+
+	res := RateLimitResult{Limit: b.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = b.wait(1)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = b.wait(float64(b.burst))
+	return res
+}
+
+// sweep drops full buckets so the store does not grow with every client it has ever seen.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for k, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.burst) {
+			delete(s.buckets, k)
+		}
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.burst), b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// wait is the time until the bucket holds n tokens.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.tokens >= n || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (rt *Runtime) initRateLimitStore() *Runtime {
+	if rt.RateLimitStore == nil {
+		rt.RateLimitStore = NewMemoryRateLimitStore()
+	}
+	return rt
+}
+
+func (config Config) validateRateLimits() *Config {
+	for name, rl := range config.RateLimits {
+		if rl == nil {
+			config.panic(fmt.Sprintf("rateLimit %s must not be empty", name))
+		}
+		rl.Name = name
+		if rl.RequestsPerSecond <= 0 {
+			config.panic(fmt.Sprintf("rateLimit %s requestsPerSecond must be greater than 0, was: %v", name, rl.RequestsPerSecond))
+		}
+		if rl.Burst < 0 {
+			config.panic(fmt.Sprintf("rateLimit %s burst must not be negative, was: %d", name, rl.Burst))
+		}
+		if rl.Burst == 0 {
+			rl.Burst = int(math.Ceil(rl.RequestsPerSecond))
+		}
+		switch rl.Key {
+		case emptyString:
+			rl.Key = rateLimitKeyClientIP
+		case rateLimitKeyClientIP, rateLimitKeyRoute:
+		case rateLimitKeyHeader, rateLimitKeyClaim:
+			if len(rl.KeyName) == 0 {
+				config.panic(fmt.Sprintf("rateLimit %s with key %s needs keyName", name, rl.Key))
+			}
+		default:
+			config.panic(fmt.Sprintf("rateLimit %s needs key clientIP | header | claim | route, was: %v", name, rl.Key))
+		}
+	}
+
+	for _, route := range config.Routes {
+		if !route.hasRateLimit() {
+			continue
+		}
+		rl, ok := config.RateLimits[route.RateLimit]
+		if !ok {
+			config.panic(fmt.Sprintf("route [%s] rateLimit [%s] not found, check your configuration", route.Path, route.RateLimit))
+		}
+		if rl.Key == rateLimitKeyClaim && !route.hasJwt() {
+			config.panic(fmt.Sprintf("route [%s] rateLimit [%s] with key claim needs route jwt", route.Path, route.RateLimit))
+		}
+	}
+	return &config
+}
+
+// rateLimitKey identifies the bucket of the downstream request. Requests without the header or claim fall back to
+// the client IP, or the remote address if it has none.
+func (proxy *Proxy) rateLimitKey(rl *RateLimit) string {
+	bucket := rl.Name + "|" + proxy.Route.key()
+	switch rl.Key {
+	case rateLimitKeyRoute:
+		return bucket
+	case rateLimitKeyHeader:
+		if v := proxy.Dwn.Req.Header.Get(rl.KeyName); len(v) > 0 {
+			return bucket + "|" + rl.Key + "|" + v
+		}
+	case rateLimitKeyClaim:
+		var v interface{}
+		if proxy.token != nil && proxy.token.Get(rl.KeyName, &v) == nil && v != nil {
+			return bucket + "|" + rl.Key + "|" + fmt.Sprint(v)
+		}
+	}
+	client := proxy.Dwn.Req.RemoteAddr
+	if ip := proxy.clientIP(); ip != nil {
+		client = ip.String()
+	}
+	return bucket + "|" + rateLimitKeyClientIP + "|" + client
+}
+
+// takeRateLimit takes a token for the downstream request from the bucket of its route.
+func (proxy *Proxy) takeRateLimit() RateLimitResult {
+	rt := proxy.runtime()
+	rl := rt.RateLimits[proxy.Route.RateLimit]
+	key := proxy.rateLimitKey(rl)
+	res := rt.RateLimitStore.Take(key, rl, time.Now())
+	if !res.Allowed {
+		infoOrTraceEv(proxy).
+			Str(XRequestID, proxy.XRequestID).
+			Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+			Msgf(rateLimitApplied, rl.Name, key)
+	}
+	return res
+}
+
+// writeRateLimitHeaders sends RateLimit-* headers, see https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+func (proxy *Proxy) writeRateLimitHeaders(res RateLimitResult) {
+	h := proxy.Dwn.Resp.Writer.Header()
+	h.Set(rateLimitHeaderLimit, strconv.Itoa(res.Limit))
+	h.Set(rateLimitHeaderRemaining, strconv.Itoa(res.Remaining))
+	h.Set(rateLimitHeaderReset, strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		h.Set(retryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func rateLimited(proxy *Proxy, res RateLimitResult) {
+	proxy.writeRateLimitHeaders(res)
+	proxy.observeRateLimited()
+	sendStatusCodeAsJSON(proxy.respondWith(http.StatusTooManyRequests, fmt.Sprintf(rateLimitExceeded, ceilSeconds(res.RetryAfter))))
+}
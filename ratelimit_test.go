@@ -0,0 +1,174 @@
+package j8a
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rl := &RateLimit{Name: "rl", RequestsPerSecond: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if res := store.Take("k", rl, now); !res.Allowed {
+			t.Errorf("request %d within burst should be allowed", i+1)
+		}
+	}
+	res := store.Take("k", rl, now)
+	if res.Allowed || res.Remaining != 0 || res.Limit != 2 {
+		t.Errorf("request beyond burst should be limited, got %+v", res)
+	}
+	if res.RetryAfter != time.Second || res.Reset != time.Second*2 {
+		t.Errorf("want retry after 1s and reset 2s, got %v and %v", res.RetryAfter, res.Reset)
+	}
+	if !store.Take("other", rl, now).Allowed {
+		t.Errorf("other key should have its own bucket")
+	}
+	if !store.Take("k", rl, now.Add(time.Second)).Allowed {
+		t.Errorf("bucket should refill after 1s")
+	}
+}
+
+func TestMemoryRateLimitStoreSweepsFullBuckets(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rl := &RateLimit{Name: "rl", RequestsPerSecond: 10, Burst: 10}
+	now := time.Now()
+	store.Take("k", rl, now)
+	store.Take("k2", rl, now.Add(rateLimitSweepInterval*2))
+
+	if _, ok := store.buckets["k"]; ok || len(store.buckets) != 1 {
+		t.Errorf("full bucket should have been swept, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestValidateRateLimitsDefaults(t *testing.T) {
+	config := &Config{
+		RateLimits: map[string]*RateLimit{"rl": {RequestsPerSecond: 2.5}},
+		Routes:     Routes{{Path: "/", RateLimit: "rl"}},
+	}
+	config = config.validateRateLimits()
+
+	rl := config.RateLimits["rl"]
+	if rl.Name != "rl" || rl.Key != rateLimitKeyClientIP || rl.Burst != 3 {
+		t.Errorf("want rate limit defaults, got %+v", rl)
+	}
+}
+
+func TestValidateRateLimitsFails(t *testing.T) {
+	var tests = []struct {
+		n string
+		c Config
+	}{
+		{"no rate", Config{RateLimits: map[string]*RateLimit{"rl": {}}}},
+		{"bad key", Config{RateLimits: map[string]*RateLimit{"rl": {RequestsPerSecond: 1, Key: "cookie"}}}},
+		{"header without keyName", Config{RateLimits: map[string]*RateLimit{"rl": {RequestsPerSecond: 1, Key: rateLimitKeyHeader}}}},
+		{"route refers missing", Config{Routes: Routes{{Path: "/", RateLimit: "missing"}}}},
+		{"claim without jwt", Config{
+			RateLimits: map[string]*RateLimit{"rl": {RequestsPerSecond: 1, Key: rateLimitKeyClaim, KeyName: "sub"}},
+			Routes:     Routes{{Path: "/", RateLimit: "rl"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			tt.c.validateRateLimits()
+		})
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	Runner = mockRuntime()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.1.1:4000"
+	req.Header.Set("X-Api-Key", "abc")
+	proxy := Proxy{Route: &Route{Path: "/"}, Dwn: Down{Req: req}}
+
+	var tests = []struct {
+		n    string
+		rl   RateLimit
+		want string
+	}{
+		{"route", RateLimit{Name: "rl", Key: rateLimitKeyRoute}, "rl|/"},
+		{"clientIP", RateLimit{Name: "rl", Key: rateLimitKeyClientIP}, "rl|/|clientIP|10.1.1.1"},
+		{"header", RateLimit{Name: "rl", Key: rateLimitKeyHeader, KeyName: "X-Api-Key"}, "rl|/|header|abc"},
+		{"missing header falls back to clientIP", RateLimit{Name: "rl", Key: rateLimitKeyHeader, KeyName: "X-Other"}, "rl|/|clientIP|10.1.1.1"},
+		{"missing claim falls back to clientIP", RateLimit{Name: "rl", Key: rateLimitKeyClaim, KeyName: "sub"}, "rl|/|clientIP|10.1.1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if got := proxy.rateLimitKey(&tt.rl); got != tt.want {
+				t.Errorf("want key %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitKeyTellsRoutesApart(t *testing.T) {
+	Runner = mockRuntime()
+	req := httptest.NewRequest("GET", "/", nil)
+	rl := RateLimit{Name: "rl", Key: rateLimitKeyRoute}
+	stable := Proxy{Route: &Route{Path: "/", PathType: prefixS}, Dwn: Down{Req: req}}
+	canary := Proxy{Route: &Route{Path: "/", PathType: prefixS, Match: &RouteMatch{Headers: []ValueMatch{{Name: "X-Canary", Value: "1"}}}}, Dwn: Down{Req: req}}
+	host := Proxy{Route: &Route{Host: "api.example.com", Path: "/", PathType: prefixS}, Dwn: Down{Req: req}}
+
+	keys := map[string]bool{stable.rateLimitKey(&rl): true, canary.rateLimitKey(&rl): true, host.rateLimitKey(&rl): true}
+	if len(keys) != 3 {
+		t.Errorf("routes with the same path should not share rate limit buckets, got %v", keys)
+	}
+}
+
+func TestRateLimitKeyWithoutClientIP(t *testing.T) {
+	Runner = mockRuntime()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "@unix"
+	proxy := Proxy{Route: &Route{Path: "/"}, Dwn: Down{Req: req}}
+
+	if got, want := proxy.rateLimitKey(&RateLimit{Name: "rl", Key: rateLimitKeyClientIP}), "rl|/|clientIP|@unix"; got != want {
+		t.Errorf("want key %s, got %s", want, got)
+	}
+}
+
+func TestProxyHandlerRateLimited(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.RateLimits = map[string]*RateLimit{"rl": {Name: "rl", Key: rateLimitKeyRoute, RequestsPerSecond: 0.1, Burst: 1}}
+	Runner.Routes[0].RateLimit = "rl"
+	Runner.RateLimitStore = NewMemoryRateLimitStore()
+	httpClient = &MockHttp{}
+	mockDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"key":"value"}`))),
+		}, nil
+	}
+
+	server := httptest.NewServer(&ProxyHttpHandler{})
+	defer server.Close()
+
+	resp, _ := http.Get(server.URL)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("first request within burst should pass, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(server.URL)
+	resp.Body.Close()
+	if resp.StatusCode != 429 {
+		t.Errorf("second request should be rate limited, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get(retryAfter); got != "10" {
+		t.Errorf("want Retry-After 10, got %s", got)
+	}
+	if resp.Header.Get(rateLimitHeaderLimit) != "1" || resp.Header.Get(rateLimitHeaderRemaining) != "0" {
+		t.Errorf("want RateLimit headers, got %v", resp.Header)
+	}
+}
@@ -23,15 +23,16 @@ func redirectHandler(response http.ResponseWriter, request *http.Request) {
 	//all malformed requests are rejected here and we return a 400
 	if !validate(proxy) {
 		if proxy.Dwn.ReqTooLarge {
-			sendStatusCodeAsJSON(proxy.respondWith(413, fmt.Sprintf("http request entity too large, limit is %d bytes", Runner.Connection.Downstream.MaxBodyBytes)))
+			sendStatusCodeAsJSON(proxy.respondWith(413, fmt.Sprintf("http request entity too large, limit is %d bytes", proxy.runtime().Connection.Downstream.MaxBodyBytes)))
 		} else {
 			sendStatusCodeAsJSON(proxy.respondWith(400, "bad or malformed request"))
 		}
 		return
 	}
 
-	httpPort := fmt.Sprintf(":%d", Runner.Connection.Downstream.Http.Port)
-	tlsPort := fmt.Sprintf(":%d", Runner.Connection.Downstream.Tls.Port)
+	downstream := proxy.runtime().Connection.Downstream
+	httpPort := fmt.Sprintf(":%d", downstream.Http.Port)
+	tlsPort := fmt.Sprintf(":%d", downstream.Tls.Port)
 	tlsHost := strings.Replace(request.Host, httpPort, tlsPort, 1)
 
 	target := HTTPS + tlsHost + request.URL.Path
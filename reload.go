@@ -0,0 +1,187 @@
+package j8a
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reload params for hot configuration reload. SIGHUP always reloads.
+type Reload struct {
+	// WatchIntervalSeconds polls the config file for changes and reloads it. Off if 0
+	WatchIntervalSeconds int
+
+	// WatchInterval is WatchIntervalSeconds as a duration. Takes precedence over WatchIntervalSeconds.
+	WatchInterval Duration
+}
+
+// ConfigReload is the outcome of the last configuration reload, exposed on /about.
+type ConfigReload struct {
+	Trigger string
+	Time    time.Time
+	Success bool
+	Error   string `json:",omitempty"`
+}
+
+// Reloader serialises configuration reloads and remembers the last outcome.
+type Reloader struct {
+	lock    sync.Mutex
+	last    atomic.Pointer[ConfigReload]
+	modTime time.Time
+}
+
+const reloadSignal = "signal"
+const reloadFileChange = "fileChange"
+
+const cfgReloadStarted = "config reload triggered by %s"
+const cfgReloadSuccess = "config reload successful, now serving %d live routes"
+const cfgReloadFailed = "config reload failed, keeping previous config, cause: %v"
+const cfgReloadRestartRequired = "config reload does not apply changed %s, restart required"
+const cfgWatchStarted = "config file watcher started for '%s', interval %v"
+const cfgWatchUnavailable = "config file watcher unavailable, config loaded from env %s"
+
+func (reload Reload) watchIntervalDuration() time.Duration {
+	return durationOrSeconds(reload.WatchInterval, reload.WatchIntervalSeconds)
+}
+
+// NewReloader creates the Reloader of a runtime.
+func NewReloader() *Reloader {
+	return &Reloader{}
+}
+
+// ReloadConfig re-runs the config validation chain and swaps the runtime config if it is valid.
+func ReloadConfig() {
+	if Runner != nil {
+		Runner.Reloader.reload(reloadSignal)
+	}
+}
+
+func (runtime *Runtime) initReloader() *Runtime {
+	if runtime.Reload == nil || runtime.Reload.watchIntervalDuration() == 0 {
+		return runtime
+	}
+	file := configFilePath()
+	if len(file) == 0 {
+		log.Warn().Msgf(cfgWatchUnavailable, J8ACFG_YML)
+		return runtime
+	}
+	if fi, err := os.Stat(file); err == nil {
+		runtime.Reloader.modTime = fi.ModTime()
+	}
+	go runtime.Reloader.watch(file, runtime.Reload.watchIntervalDuration())
+	log.Info().Msgf(cfgWatchStarted, file, runtime.Reload.watchIntervalDuration())
+	return runtime
+}
+
+// configFilePath mirrors the precedence of Config.load(). Returns empty string if config comes from env.
+func configFilePath() string {
+	if len(ConfigFile) > 0 {
+		return ConfigFile
+	}
+	if len(os.Getenv(J8ACFG_YML)) > 0 {
+		return emptyString
+	}
+	return DefaultConfigFile
+}
+
+func (rl *Reloader) watch(file string, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		fi, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		rl.lock.Lock()
+		changed := !fi.ModTime().Equal(rl.modTime)
+		rl.modTime = fi.ModTime()
+		rl.lock.Unlock()
+		if changed {
+			rl.reload(reloadFileChange)
+		}
+	}
+}
+
+// reload swaps the live Runtime for a copy with reloaded routes, resources, policies, jwt, load balancing and log
+// config. Listeners, connection params and stateful components carry over. In-flight requests keep the Runtime
+// they started with. Log settings are applied only after the whole config passed validation.
+func (rl *Reloader) reload(trigger string) *ConfigReload {
+	if rl == nil {
+		return nil
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	log.Info().Msgf(cfgReloadStarted, trigger)
+	outcome := &ConfigReload{Trigger: trigger, Time: time.Now()}
+	config, err := safeLoadConfig()
+	if err != nil {
+		outcome.Error = err.Error()
+		rl.last.Store(outcome)
+		log.Warn().Msgf(cfgReloadFailed, err)
+		return outcome
+	}
+
+	current := currentRuntime()
+	next := current.reloaded(config)
+	liveRuntime.Store(next)
+	current.HealthChecks.retire(next.HealthChecks)
+	config.applyTimeZone()
+	config.applyLogLevel()
+
+	outcome.Success = true
+	rl.last.Store(outcome)
+	log.Info().Msgf(cfgReloadSuccess, next.Routes.Len())
+	return outcome
+}
+
+// lastReload is the outcome of the last reload, nil if there was none.
+func (rl *Reloader) lastReload() *ConfigReload {
+	if rl == nil {
+		return nil
+	}
+	return rl.last.Load()
+}
+
+// safeLoadConfig runs the validation chain and turns its panics into an error.
+func safeLoadConfig() (config *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			config = nil
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return loadConfig(), nil
+}
+
+func (runtime *Runtime) reloaded(config *Config) *Runtime {
+	if !reflect.DeepEqual(runtime.Connection, config.Connection) {
+		log.Warn().Msgf(cfgReloadRestartRequired, "connection")
+	}
+	if !reflect.DeepEqual(runtime.Tracing, config.Tracing) {
+		log.Warn().Msgf(cfgReloadRestartRequired, "tracing")
+	}
+
+	next := *runtime
+	next.TimeZone = config.TimeZone
+	next.timeZone = config.timeZone
+	next.LogLevel = config.LogLevel
+	next.logLevel = config.logLevel
+	next.Routes = config.Routes
+	next.routeMatcher = config.routeMatcher
+	next.Resources = config.Resources
+	next.Policies = config.Policies
+	next.Jwt = config.Jwt
+	next.LoadBalancing = config.LoadBalancing
+	next.RateLimits = config.RateLimits
+	//the global limit is a connection param and needs a restart like the others
+	next.ConcurrencyLimiters = NewConcurrencyLimiters(runtime.Connection.Upstream.Concurrency, resourceConcurrency(config.Resources)).
+		carryOver(runtime.ConcurrencyLimiters)
+	next.HealthChecks = NewHealthChecks(config.Resources).carryOver(runtime.HealthChecks)
+	next.HealthChecks.start()
+	return &next
+}
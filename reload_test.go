@@ -0,0 +1,183 @@
+package j8a
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const reloadTestConfig = `---
+connection:
+  downstream:
+    http:
+      port: 8080
+resources:
+  reloaded:
+    - url:
+        scheme: http
+        host: localhost
+        port: 60083
+routes:
+  - path: /reloaded
+    resource: reloaded
+`
+
+const reloadTestConfigInvalid = `---
+connection:
+  downstream:
+    http:
+      port: 8080
+routes:
+  - path: /reloaded
+    resource: missing
+`
+
+func writeReloadTestConfig(t *testing.T, content string) {
+	file := filepath.Join(t.TempDir(), "j8acfg.yml")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ConfigFile = file
+	t.Cleanup(func() {
+		ConfigFile = ""
+		liveRuntime.Store(nil)
+	})
+}
+
+func TestReloadSwapsRoutesAndKeepsInFlightRuntime(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Reloader = NewReloader()
+	previous := Runner
+	writeReloadTestConfig(t, reloadTestConfig)
+
+	req, _ := http.NewRequest("GET", "/reloaded", nil)
+	inFlight := new(Proxy).parseIncomingHeaders(req)
+
+	outcome := Runner.Reloader.reload(reloadSignal)
+	if !outcome.Success || len(outcome.Error) > 0 {
+		t.Fatalf("reload should succeed, got %+v", outcome)
+	}
+	live := currentRuntime()
+	if live == previous || Runner != previous {
+		t.Fatal("reload should swap the live runtime and keep the boot runtime")
+	}
+	if live.Routes.Len() != 1 || live.Routes[0].Path != "/reloaded" {
+		t.Errorf("reload did not swap routes, got %v", live.Routes)
+	}
+	if _, ok := live.Resources["reloaded"]; !ok {
+		t.Errorf("reload did not swap resources")
+	}
+	if live.Connection.Downstream.Http.Port != previous.Connection.Downstream.Http.Port {
+		t.Errorf("reload should keep connection params")
+	}
+	if live.ConnectionWatcher != previous.ConnectionWatcher || live.Reloader != previous.Reloader {
+		t.Errorf("reload should carry over runtime components")
+	}
+	if inFlight.runtime() != previous || !matchRoutes(req, inFlight) || inFlight.Route.Resource != "default" {
+		t.Errorf("in-flight proxy should keep the runtime it started with")
+	}
+	pinned := new(Proxy).parseIncomingHeaders(withRuntime(req, previous))
+	if pinned.runtime() != previous {
+		t.Errorf("proxy should use the runtime pinned to its request")
+	}
+	if live.Reloader.lastReload() != outcome {
+		t.Errorf("reload outcome not recorded")
+	}
+}
+
+func TestReloadKeepsPreviousConfigIfInvalid(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Reloader = NewReloader()
+	previous := Runner
+	writeReloadTestConfig(t, reloadTestConfigInvalid)
+
+	outcome := Runner.Reloader.reload(reloadFileChange)
+	if outcome.Success || len(outcome.Error) == 0 {
+		t.Fatalf("reload should fail, got %+v", outcome)
+	}
+	if currentRuntime() != previous || previous.Routes.Len() != 2 {
+		t.Errorf("failed reload should keep previous runtime")
+	}
+	if outcome.Trigger != reloadFileChange {
+		t.Errorf("want trigger %v, got %v", reloadFileChange, outcome.Trigger)
+	}
+}
+
+func TestHealthChecksCarryOverAfterReload(t *testing.T) {
+	u := URL{Scheme: "http", Host: "localhost", Port: "60083"}
+	resources := map[string][]ResourceMapping{
+		"r": {{Name: "r", URL: u, HealthCheck: &HealthCheck{Path: "/", IntervalSeconds: 1, TimeoutSeconds: 1, HealthyThreshold: 1, UnhealthyThreshold: 1}}},
+	}
+
+	previous := NewHealthChecks(resources)
+	previous.update(previous.states[u.String()], false, "test")
+	if previous.isHealthy(u) {
+		t.Fatal("upstream should be unhealthy")
+	}
+
+	next := NewHealthChecks(resources).carryOver(previous)
+	if next.isHealthy(u) {
+		t.Errorf("health state should carry over after reload")
+	}
+	if next.states[u.String()] != previous.states[u.String()] {
+		t.Fatal("unchanged health check should be shared with the previous runtime")
+	}
+
+	previous.retire(next)
+	select {
+	case <-previous.states[u.String()].done:
+		t.Errorf("shared health check should keep probing after reload")
+	default:
+	}
+}
+
+func TestHealthChecksRetiredAfterReload(t *testing.T) {
+	u := URL{Scheme: "http", Host: "localhost", Port: "60083"}
+	check := HealthCheck{Path: "/", IntervalSeconds: 1, TimeoutSeconds: 1, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	changed := check
+	changed.Path = "/health"
+
+	previous := NewHealthChecks(map[string][]ResourceMapping{"r": {{Name: "r", URL: u, HealthCheck: &check}}})
+	previous.update(previous.states[u.String()], false, "test")
+	next := NewHealthChecks(map[string][]ResourceMapping{"r": {{Name: "r", URL: u, HealthCheck: &changed}}}).
+		carryOver(previous)
+	if next.states[u.String()] == previous.states[u.String()] || next.isHealthy(u) {
+		t.Errorf("changed health check should get a new probe that starts with the previous health")
+	}
+
+	previous.retire(next)
+	select {
+	case <-previous.states[u.String()].done:
+	default:
+		t.Errorf("replaced health check should stop probing after reload")
+	}
+}
+
+func withLogLevel(config string, level string) string {
+	return strings.Replace(config, "---\n", "---\nlogLevel: "+level+"\n", 1)
+}
+
+func TestReloadAppliesLogLevelOnlyIfValid(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Reloader = NewReloader()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	t.Cleanup(func() {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	})
+
+	writeReloadTestConfig(t, withLogLevel(reloadTestConfigInvalid, "warn"))
+	Runner.Reloader.reload(reloadSignal)
+	if got := zerolog.GlobalLevel(); got != zerolog.InfoLevel {
+		t.Errorf("failed reload should keep log level, got %v", got)
+	}
+
+	writeReloadTestConfig(t, withLogLevel(reloadTestConfig, "warn"))
+	Runner.Reloader.reload(reloadSignal)
+	if got := zerolog.GlobalLevel(); got != zerolog.WarnLevel {
+		t.Errorf("reload should apply log level, got %v", got)
+	}
+}
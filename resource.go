@@ -1,8 +1,80 @@
 package j8a
 
+import "time"
+
 //ResourceMapping describes upstream servers
 type ResourceMapping struct {
-	Name   string
-	Labels []string
-	URL    URL
+	Name        string
+	Labels      []string
+	URL         URL
+	HealthCheck *HealthCheck
+	// Weight is the share of traffic for the weighted load balancing strategy, defaults to 1. A weight of 0 sends
+	// no traffic to the mapping with any strategy, i.e. to drain it.
+	Weight *float64
+	// Concurrency caps in-flight upstream requests of the whole resource. Off unless configured, mappings of the
+	// same resource that set it must agree.
+	Concurrency *Concurrency
+}
+
+func (rm ResourceMapping) hasLabel(label string) bool {
+	for _, l := range rm.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (rm ResourceMapping) weight() float64 {
+	if rm.Weight == nil {
+		return 1
+	}
+	return *rm.Weight
+}
+
+// HealthCheck describes an active upstream probe for a resource mapping.
+type HealthCheck struct {
+	// Path is requested with GET on the upstream URL, defaults to /
+	Path string
+
+	// IntervalSeconds is the wait period between probes. Defaults to 10
+	IntervalSeconds int
+
+	// Interval is IntervalSeconds as a duration, i.e. "500ms". Takes precedence over IntervalSeconds.
+	Interval Duration
+
+	// TimeoutSeconds is the maximum duration of a single probe, must not exceed the interval. Defaults to 2
+	TimeoutSeconds int
+
+	// Timeout is TimeoutSeconds as a duration. Takes precedence over TimeoutSeconds.
+	Timeout Duration
+
+	// StatusCodes are the expected probe response codes, defaults to any 2xx.
+	StatusCodes []int
+
+	// HealthyThreshold is the number of consecutive successful probes before an unhealthy upstream is healthy again.
+	HealthyThreshold int
+
+	// UnhealthyThreshold is the number of consecutive failed probes before an upstream is unhealthy.
+	UnhealthyThreshold int
+}
+
+func (hc HealthCheck) expects(statusCode int) bool {
+	if len(hc.StatusCodes) == 0 {
+		return statusCode >= 200 && statusCode <= 299
+	}
+	for _, c := range hc.StatusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (hc HealthCheck) intervalDuration() time.Duration {
+	return durationOrSeconds(hc.Interval, hc.IntervalSeconds)
+}
+
+func (hc HealthCheck) timeoutDuration() time.Duration {
+	return durationOrSeconds(hc.Timeout, hc.TimeoutSeconds)
 }
@@ -80,6 +80,10 @@ func (s Routes) Swap(i, j int) {
 }
 func (s Routes) Less(i, j int) bool {
 	if s[i].PunyHost == s[j].PunyHost {
+		//slug ordering can't tell the same path apart, so the more constrained route goes first
+		if s[i].Path == s[j].Path && s[i].PathType == s[j].PathType {
+			return s[i].Match.specificity() > s[j].Match.specificity()
+		}
 		return s.PathIsLess(i, j)
 	} else {
 		return s.HostIsLess(i, j)
@@ -95,14 +99,32 @@ func (s Routes) PathIsLess(i int, j int) bool {
 	pjs := NewRoutePath(s[j])
 
 	less := false
-	if (s[i].PathType == exact && s[j].PathType == exact) || (s[i].PathType == prefixS && s[j].PathType == prefixS) {
+	if s[i].PathType == regexS && s[j].PathType == regexS {
+		//longer patterns are usually more specific, ties sort by pattern so the order is stable across reloads
+		if len(s[i].Path) != len(s[j].Path) {
+			less = len(s[i].Path) > len(s[j].Path)
+		} else {
+			less = s[i].Path < s[j].Path
+		}
+	} else if (s[i].PathType == exact && s[j].PathType == exact) || (s[i].PathType == prefixS && s[j].PathType == prefixS) {
 		less = WeightedSlugs(pis).Less(WeightedSlugs(pjs))
 	} else {
-		less = s[i].PathType == exact
+		less = pathTypeRank(s[i].PathType) < pathTypeRank(s[j].PathType)
 	}
 	return less
 }
 
+// pathTypeRank orders exact before regex before prefix routes.
+func pathTypeRank(pathType string) int {
+	switch pathType {
+	case exact:
+		return 0
+	case regexS:
+		return 1
+	}
+	return 2
+}
+
 // Route maps a Path to an upstream resource
 type Route struct {
 	Host              string         //idna host pattern
@@ -111,10 +133,121 @@ type Route struct {
 	Path              string
 	PathType          string // exact | prefix
 	CompiledPathRegex *regexp.Regexp
+	Match             *RouteMatch // optional method, header, query and cookie criteria
 	Transform         string
+	CompiledTransform string // transform as regexp template, if it refers to path params or capture groups
 	Resource          string
 	Policy            string
+	Retry             *Retry
 	Jwt               string
+	// RateLimit is the name of the rate limit policy applied to downstream requests of this route.
+	RateLimit string
+	// IPFilter allows or denies downstream requests of this route by client IP, in addition to the global one.
+	IPFilter *IPFilter
+	// RequestHeaders change the headers sent upstream.
+	RequestHeaders *HeaderRules
+	// ResponseHeaders change the headers sent downstream.
+	ResponseHeaders *HeaderRules
+	// HostHeader is the Host sent upstream, one of rewrite | preserve. Defaults to rewrite, the upstream host
+	HostHeader string
+	// StreamResponse copies upstream response bodies downstream as they arrive instead of buffering them.
+	StreamResponse bool
+	// StreamRequest sends downstream request bodies upstream without reading them into memory first.
+	StreamRequest bool
+	// Upstream overrides connection upstream timeouts and maxAttempts for this route
+	Upstream *RouteUpstream
+	// Downstream overrides connection downstream roundTripTimeout and maxBodyBytes for this route
+	Downstream *RouteDownstream
+}
+
+// RouteUpstream overrides connection upstream params for a single route. Zero values use the connection params.
+// Routes with an idleTimeout keep their idle upstream connections in a separate pool.
+type RouteUpstream struct {
+	SocketTimeoutSeconds int
+	SocketTimeout        Duration
+	ReadTimeoutSeconds   int
+	ReadTimeout          Duration
+	IdleTimeoutSeconds   int
+	IdleTimeout          Duration
+	MaxAttempts          int
+}
+
+// RouteDownstream overrides connection downstream params for a single route. Zero values use the connection params.
+type RouteDownstream struct {
+	RoundTripTimeoutSeconds int
+	RoundTripTimeout        Duration
+	MaxBodyBytes            int64
+}
+
+// Retry tunes which failed upstream attempts of a route are retried, up to MaxAttempts.
+type Retry struct {
+	// StatusCodes are the retryable upstream response codes. Other 5xx are sent downstream. Defaults to any 5xx
+	StatusCodes []int
+
+	// Errors are the retryable upstream error classes connectRefused | upstreamHangup | readTimeout | other.
+	// Defaults to all errors
+	Errors []string
+
+	// NonIdempotent retries POST, PATCH and CONNECT if the upstream request was never sent
+	NonIdempotent bool
+
+	// IdempotencyKey retries non idempotent methods if the downstream request carries an Idempotency-Key header
+	IdempotencyKey bool
+}
+
+const connectRefused = "connectRefused"
+const upstreamHangupS = "upstreamHangup"
+const readTimeout = "readTimeout"
+const otherUpstreamError = "other"
+
+var retryErrorClasses = []string{connectRefused, upstreamHangupS, readTimeout, otherUpstreamError}
+
+func (retry *Retry) retriesStatusCode(statusCode int) bool {
+	if statusCode < 500 {
+		return false
+	}
+	if retry == nil || len(retry.StatusCodes) == 0 {
+		return true
+	}
+	for _, c := range retry.StatusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (retry *Retry) retriesErrorClass(class string) bool {
+	if retry == nil || len(retry.Errors) == 0 {
+		return true
+	}
+	for _, e := range retry.Errors {
+		if e == class {
+			return true
+		}
+	}
+	return false
+}
+
+func (route Route) validRetry() (bool, error) {
+	if route.Retry == nil {
+		return true, nil
+	}
+	for _, c := range route.Retry.StatusCodes {
+		if c < 500 || c > 599 {
+			return false, errors.New(fmt.Sprintf("route %s retry statusCodes must be between 500 and 599, was: %d", route.Path, c))
+		}
+	}
+Errors:
+	for _, e := range route.Retry.Errors {
+		for _, class := range retryErrorClasses {
+			if e == class {
+				continue Errors
+			}
+		}
+		return false, errors.New(fmt.Sprintf("route %s retry errors must be one of %v, was: %s", route.Path, retryErrorClasses, e))
+	}
+	return true, nil
 }
 
 const wildcard = "*"
@@ -180,6 +313,17 @@ func (route *Route) validPath() (bool, error) {
 	const fakeHost = "http://127.0.0.1"
 	defaultError := errors.New(fmt.Sprintf("route %v not a valid URL path", route.Path))
 
+	//regex paths are patterns, not URLs
+	if route.PathType == regexS {
+		if len(route.Path) == 0 || strings.Index(route.Path, "/") != 0 {
+			return false, errors.New(fmt.Sprintf("route %v not a valid regex path, does not start with '/'", route.Path))
+		}
+		if e := route.compilePath(); e != nil {
+			return false, e
+		}
+		return true, nil
+	}
+
 	_, err := url.ParseRequestURI(fakeHost + route.Path)
 	if err != nil {
 		return false, defaultError
@@ -210,9 +354,17 @@ func (route *Route) validPath() (bool, error) {
 const startS = "^"
 const dollarS = "$"
 const exact = "exact"
+const regexS = "regex"
 
 func (route *Route) compilePath() error {
-	compileMe := route.Path
+	if route.PathType == regexS {
+		var err error
+		if route.CompiledPathRegex, err = regexp.Compile(startS + "(?:" + route.Path + ")" + dollarS); err != nil {
+			return errors.New(fmt.Sprintf("route %v not a valid regex path, cause %v", route.Path, err))
+		}
+		return nil
+	}
+	compileMe := compilePathParams(route.Path)
 	if string(compileMe[0]) != startS {
 		compileMe = startS + compileMe
 	}
@@ -229,9 +381,11 @@ const slashS = "/"
 func (route Route) match(request *http.Request) bool {
 	if len(route.PunyHost) > 0 {
 		return route.matchHostHeader(request) &&
-			route.matchURIPath(request)
+			route.matchURIPath(request) &&
+			route.Match.matches(request)
 	} else {
-		return route.matchURIPath(request)
+		return route.matchURIPath(request) &&
+			route.Match.matches(request)
 	}
 }
 
@@ -270,42 +424,61 @@ const emptyString = ""
 
 // maps a route to a URL. Returns the URL, the name of the mapped policy and whether mapping was successful
 func (route Route) mapURL(proxy *Proxy) (*URL, string, bool) {
-	var policy Policy
-	var policyLabel string
+	policyLabel := defaultMsg
 	if len(route.Policy) > 0 {
-		policy = Runner.Policies[route.Policy]
-		policyLabel = policy.resolveLabel()
+		policyLabel = proxy.runtime().Policies[route.Policy].resolveLabel()
 	}
+	return route.chooseURL(proxy, policyLabel, false)
+}
+
+// remapURL maps a route to a URL for a retry. It keeps the label of the current attempt and prefers
+// upstreams that were not yet attempted.
+func (route Route) remapURL(proxy *Proxy) (*URL, string, bool) {
+	return route.chooseURL(proxy, proxy.Up.Atmpt.Label, true)
+}
+
+const lbStrategy = "lbStrategy"
 
-	resource := Runner.Resources[route.Resource]
+func (route Route) chooseURL(proxy *Proxy, policyLabel string, retry bool) (*URL, string, bool) {
+	resource := proxy.runtime().Resources[route.Resource]
 	if resource == nil {
 		return nil, emptyString, false
 	}
-	//if a policy exists, we match resources with a label. TODO: this should be an interface
 
-	if len(route.Policy) > 0 {
-		for _, resourceMapping := range resource {
-			for _, resourceLabel := range resourceMapping.Labels {
-				if policyLabel == resourceLabel {
-					infoOrTraceEv(proxy).Str(routeMsg, route.Path).
-						Str(upResource, resourceMapping.URL.String()).
-						Str(labelMsg, resourceLabel).
-						Str(policyMsg, route.Policy).
-						Str(XRequestID, proxy.XRequestID).
-						Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
-						Msg(upstreamResourceMapped)
-					return &resourceMapping.URL, policyLabel, true
-				}
-			}
+	//if a policy exists, we match resources with a label, then let the load balancer pick among them.
+	var candidates []*ResourceMapping
+	for i := range resource {
+		if resource[i].weight() == 0 || !proxy.runtime().isUpstreamAvailable(resource[i].URL) {
+			continue
 		}
-	} else {
-		infoOrTraceEv(proxy).
+		if len(route.Policy) > 0 && !resource[i].hasLabel(policyLabel) {
+			continue
+		}
+		candidates = append(candidates, &resource[i])
+	}
+	if retry {
+		if untried := proxy.untriedResourceMappings(candidates); len(untried) > 0 {
+			candidates = untried
+		}
+	}
+
+	if len(candidates) > 0 {
+		strategy, chosen := proxy.runtime().loadBalance(route.Resource, candidates, proxy)
+		ev := infoOrTraceEv(proxy).
 			Str(routeMsg, route.Path).
-			Str(policyMsg, defaultMsg).
-			Str(XRequestID, proxy.XRequestID).
-			Str(upResource, resource[0].URL.String()).
+			Str(upResource, chosen.URL.String()).
+			Str(lbStrategy, strategy).
+			Str(XRequestID, proxy.XRequestID)
+		if len(route.Policy) > 0 {
+			ev.Str(labelMsg, policyLabel).
+				Str(policyMsg, route.Policy).
+				Int64(dwnElpsdMicros, time.Since(proxy.Dwn.startDate).Microseconds()).
+				Msg(upstreamResourceMapped)
+			return &chosen.URL, policyLabel, true
+		}
+		ev.Str(policyMsg, defaultMsg).
 			Msg(routeMapped)
-		return &resource[0].URL, defaultMsg, true
+		return &chosen.URL, defaultMsg, true
 	}
 
 	infoOrTraceEv(proxy).
@@ -316,14 +489,31 @@ func (route Route) mapURL(proxy *Proxy) (*URL, string, bool) {
 	return nil, emptyString, false
 }
 
+// key identifies the route by host, path and match criteria, so canary routes with the same path differ. It is stable
+// across config reloads.
+func (route Route) key() string {
+	key := route.Host + route.Path
+	if len(route.PathType) > 0 {
+		key += " " + route.PathType
+	}
+	if route.Match != nil {
+		key += " " + route.Match.key()
+	}
+	return key
+}
+
 func (route Route) hasJwt() bool {
 	return len(route.Jwt) > 0
 }
 
+func (route Route) hasRateLimit() bool {
+	return len(route.RateLimit) > 0
+}
+
 type RoutePathTypes []string
 
 func NewRoutePathTypes() RoutePathTypes {
-	return RoutePathTypes([]string{"exact", "prefix"})
+	return RoutePathTypes([]string{exact, prefixS, regexS})
 }
 
 func (r RoutePathTypes) isValid(t string) bool {
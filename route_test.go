@@ -1,6 +1,7 @@
 package j8a
 
 import (
+	"fmt"
 	"github.com/rs/zerolog"
 	"golang.org/x/net/idna"
 	"net/http"
@@ -168,6 +169,52 @@ func TestRouteExactMatch(t *testing.T) {
 	doRunRouteMatchingTests(t, tests)
 }
 
+func TestRouteRegexMatch(t *testing.T) {
+	tests := []struct {
+		n string
+		r string
+		t string
+		u string
+		v bool
+	}{
+		{n: "match pattern", r: "/users/[0-9]+", t: "regex", u: "/users/42", v: true},
+		{n: "match pattern with params", r: "/users/[0-9]+", t: "regex", u: "/users/42?k=v", v: true},
+		{n: "anchored at end", r: "/users/[0-9]+", t: "regex", u: "/users/42/orders", v: false},
+		{n: "anchored at start", r: "/users/[0-9]+", t: "regex", u: "/api/users/42", v: false},
+		{n: "alternation is anchored", r: "/a|/b", t: "regex", u: "/b/c", v: false},
+		{n: "named group", r: "/users/(?P<id>[0-9]+)/orders", t: "regex", u: "/users/42/orders", v: true},
+		{n: "no trailing slash fallback", r: "/users/", t: "regex", u: "/users", v: false},
+	}
+
+	doRunRouteMatchingTests(t, tests)
+}
+
+func TestRouteRegexPathInvalid(t *testing.T) {
+	for _, p := range []string{"/users/(", "/users/[0-9", "users/.*", "/a/(?P<id"} {
+		r := Route{Path: p, PathType: "regex"}
+		if v, e := r.validPath(); v || e == nil {
+			t.Errorf("regex routepath %v should be invalid", p)
+		}
+	}
+}
+
+func TestRouteRegexPathLess(t *testing.T) {
+	routes := Routes{
+		{Path: "/", PathType: "prefix", Resource: "prefix"},
+		{Path: "/users/[0-9]+", PathType: "regex", Resource: "short regex"},
+		{Path: "/users/[0-9]+/orders", PathType: "regex", Resource: "long regex"},
+		{Path: "/users/me", PathType: "exact", Resource: "exact"},
+	}
+	sort.Sort(routes)
+
+	want := []string{"exact", "long regex", "short regex", "prefix"}
+	for i, w := range want {
+		if routes[i].Resource != w {
+			t.Errorf("want route %d to be %s, got %s", i, w, routes[i].Resource)
+		}
+	}
+}
+
 func TestRouteUnicodeMatch(t *testing.T) {
 	tests := []struct {
 		n string
@@ -291,6 +338,9 @@ func TestRoutePathTypesAreValid(t *testing.T) {
 	if !rpt.isValid("pREFix") {
 		t.Error("prefix should be valid")
 	}
+	if !rpt.isValid("regex") {
+		t.Error("regex should be valid")
+	}
 	if rpt.isValid("") {
 		t.Error("empty string should not be valid")
 	}
@@ -319,6 +369,7 @@ func TestRoutePathsValid(t *testing.T) {
 		{n: "emoji", r: mkPrfx("/😈"), v: true},
 		{n: "unicode", r: mkPrfx("/指"), v: true},
 		{n: "regex", r: mkPrfx("/a/b/*"), v: true},
+		{n: "path param", r: mkPrfx("/v1/users/{id}/orders"), v: true},
 
 		{n: "regex", r: mkPrfx("/a/b/**"), v: false},
 		{n: "no space", r: mkPrfx("/a a"), v: false},
@@ -824,6 +875,67 @@ func BenchmarkRouteMatchingRegexNaiveBusyVersion(b *testing.B) {
 	}
 }
 
+func BenchmarkRouteMatchingTrie(b *testing.B) {
+	//suppress noise
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	config := new(Config).readYmlFile("./j8acfg.yml")
+	config = config.compileRoutePaths().validateRoutes().compileRouteMatcher()
+
+	for i := 0; i < b.N; i++ {
+		config.routeMatcher.match(requestFactory("/mse6"))
+	}
+}
+
+func BenchmarkRouteMatchingTrieBusyVersion(b *testing.B) {
+	//suppress noise
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	config := new(Config).readYmlFile("./j8acfg.yml")
+	config = config.compileRoutePaths().validateRoutes().compileRouteMatcher()
+
+	for i := 0; i < b.N; i++ {
+		config.routeMatcher.match(requestFactory("/s16"))
+	}
+}
+
+func mkManyRoutesConfig() *Config {
+	config := &Config{Resources: map[string][]ResourceMapping{"r": {}}}
+	for i := 0; i < 500; i++ {
+		config.Routes = append(config.Routes, Route{Path: fmt.Sprintf("/service%d/api", i), Resource: "r"})
+	}
+	config.Routes = append(config.Routes, Route{Path: "/", Resource: "r"})
+	return config.compileRoutePaths().validateRoutes().compileRouteMatcher()
+}
+
+func BenchmarkRouteMatchingRegex500Routes(b *testing.B) {
+	//suppress noise
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	config := mkManyRoutesConfig()
+	req := requestFactory("/service250/api/get")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, route := range config.Routes {
+			if ok := route.match(req); ok {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkRouteMatchingTrie500Routes(b *testing.B) {
+	//suppress noise
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	config := mkManyRoutesConfig()
+	req := requestFactory("/service250/api/get")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config.routeMatcher.match(req)
+	}
+}
+
 // we can no longer run this it's illegal. Route paths must be compiled.
 //func BenchmarkRouteMatchingString(b *testing.B) {
 //	//suppress noise
@@ -840,3 +952,26 @@ func BenchmarkRouteMatchingRegexNaiveBusyVersion(b *testing.B) {
 //		}
 //	}
 //}
+
+func TestRouteValidRetry(t *testing.T) {
+	var tests = []struct {
+		n     string
+		retry *Retry
+		valid bool
+	}{
+		{"no retry", nil, true},
+		{"gateway codes", &Retry{StatusCodes: []int{502, 503, 504}}, true},
+		{"client error code", &Retry{StatusCodes: []int{404}}, false},
+		{"error classes", &Retry{Errors: []string{connectRefused, upstreamHangupS, readTimeout, otherUpstreamError}}, true},
+		{"unknown error class", &Retry{Errors: []string{"dnsFailure"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			r := Route{Path: "/", Retry: tt.retry}
+			if got, _ := r.validRetry(); got != tt.valid {
+				t.Errorf("retry valid want %v, got %v", tt.valid, got)
+			}
+		})
+	}
+}
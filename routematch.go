@@ -0,0 +1,159 @@
+package j8a
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteMatch adds optional criteria a request must meet besides host and path. All criteria set must match.
+type RouteMatch struct {
+	// Methods the route accepts, i.e. GET, HEAD. Any method matches if empty
+	Methods []string
+	Headers []ValueMatch
+	Query   []ValueMatch
+	Cookies []ValueMatch
+}
+
+// ValueMatch matches a header, query parameter or cookie by Name. With neither Value nor Regex, presence matches.
+type ValueMatch struct {
+	Name          string
+	Value         string
+	Regex         string
+	CompiledRegex *regexp.Regexp
+}
+
+func (config Config) compileRouteMatches() *Config {
+	for i := range config.Routes {
+		if config.Routes[i].Match == nil {
+			continue
+		}
+		if err := config.Routes[i].Match.compile(); err != nil {
+			config.panic(fmt.Sprintf("route %s match %v", config.Routes[i].Path, err))
+		}
+	}
+	return &config
+}
+
+func (m *RouteMatch) compile() error {
+	for i, method := range m.Methods {
+		m.Methods[i] = strings.ToUpper(strings.TrimSpace(method))
+		legal := false
+		for _, l := range httpLegalMethods {
+			legal = legal || m.Methods[i] == l
+		}
+		if !legal {
+			return fmt.Errorf("method %s invalid, not one of %v", method, httpLegalMethods)
+		}
+	}
+	for kind, vms := range map[string][]ValueMatch{"header": m.Headers, "query": m.Query, "cookie": m.Cookies} {
+		for i := range vms {
+			if err := vms[i].compile(); err != nil {
+				return fmt.Errorf("%s %v", kind, err)
+			}
+		}
+	}
+	return nil
+}
+
+// key renders the criteria, so routes with the same path but different criteria can be told apart.
+func (m RouteMatch) key() string {
+	var b strings.Builder
+	b.WriteString(strings.Join(m.Methods, ","))
+	for _, vms := range [][]ValueMatch{m.Headers, m.Query, m.Cookies} {
+		b.WriteString(";")
+		for _, vm := range vms {
+			fmt.Fprintf(&b, "%s=%s~%s,", vm.Name, vm.Value, vm.Regex)
+		}
+	}
+	return b.String()
+}
+
+func (vm *ValueMatch) compile() error {
+	if len(vm.Name) == 0 {
+		return fmt.Errorf("needs name")
+	}
+	if len(vm.Value) > 0 && len(vm.Regex) > 0 {
+		return fmt.Errorf("%s needs one of value or regex, not both", vm.Name)
+	}
+	if len(vm.Regex) > 0 {
+		var err error
+		if vm.CompiledRegex, err = regexp.Compile(vm.Regex); err != nil {
+			return fmt.Errorf("%s regex %s invalid, cause %v", vm.Name, vm.Regex, err)
+		}
+	}
+	return nil
+}
+
+// matches tells if any of the values meets the criteria.
+func (vm ValueMatch) matches(values []string) bool {
+	for _, v := range values {
+		switch {
+		case vm.CompiledRegex != nil:
+			if vm.CompiledRegex.MatchString(v) {
+				return true
+			}
+		case len(vm.Value) > 0:
+			if v == vm.Value {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (m *RouteMatch) matches(request *http.Request) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.Methods) > 0 {
+		method := strings.ToUpper(request.Method)
+		found := false
+		for _, allowed := range m.Methods {
+			found = found || method == allowed
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, vm := range m.Headers {
+		if !vm.matches(request.Header.Values(vm.Name)) {
+			return false
+		}
+	}
+	if len(m.Query) > 0 {
+		query := request.URL.Query()
+		for _, vm := range m.Query {
+			if !vm.matches(query[vm.Name]) {
+				return false
+			}
+		}
+	}
+	for _, vm := range m.Cookies {
+		var values []string
+		for _, c := range request.Cookies() {
+			if c.Name == vm.Name {
+				values = append(values, c.Value)
+			}
+		}
+		if !vm.matches(values) {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity counts the criteria, so routes with the same host and path sort the more constrained first.
+func (m *RouteMatch) specificity() int {
+	if m == nil {
+		return 0
+	}
+	s := len(m.Headers) + len(m.Query) + len(m.Cookies)
+	if len(m.Methods) > 0 {
+		s++
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+package j8a
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestRouteMatchCriteria(t *testing.T) {
+	match := &RouteMatch{
+		Methods: []string{"get", "HEAD"},
+		Headers: []ValueMatch{{Name: "X-Canary", Value: "true"}, {Name: "Accept", Regex: `application/vnd\.api\.v2\+json`}},
+		Query:   []ValueMatch{{Name: "debug"}},
+		Cookies: []ValueMatch{{Name: "region", Value: "eu"}},
+	}
+	if err := match.compile(); err != nil {
+		t.Fatalf("match should compile, got %v", err)
+	}
+	mkReq := func(method string, header string) *http.Request {
+		req := httptest.NewRequest(method, "/api?debug", nil)
+		req.Header.Set("Accept", "application/vnd.api.v2+json")
+		req.Header.Set("Cookie", "session=1; region=eu")
+		if len(header) > 0 {
+			req.Header.Set("X-Canary", header)
+		}
+		return req
+	}
+
+	var tests = []struct {
+		n    string
+		req  *http.Request
+		want bool
+	}{
+		{"all criteria", mkReq("GET", "true"), true},
+		{"method", mkReq("POST", "true"), false},
+		{"header value", mkReq("GET", "false"), false},
+		{"header missing", mkReq("GET", ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if got := match.matches(tt.req); got != tt.want {
+				t.Errorf("want match %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	req := mkReq("GET", "true")
+	req.URL.RawQuery = ""
+	if match.matches(req) {
+		t.Errorf("missing query param should not match")
+	}
+	req = mkReq("GET", "true")
+	req.Header.Set("Cookie", "region=us")
+	if match.matches(req) {
+		t.Errorf("cookie value should not match")
+	}
+	req = mkReq("GET", "true")
+	req.Header.Set("Accept", "application/json")
+	if match.matches(req) {
+		t.Errorf("header regex should not match")
+	}
+
+	var none *RouteMatch
+	if !none.matches(req) {
+		t.Errorf("route without criteria should match")
+	}
+}
+
+func TestCompileRouteMatchesFails(t *testing.T) {
+	var tests = []struct {
+		n string
+		m RouteMatch
+	}{
+		{"bad method", RouteMatch{Methods: []string{"FETCH"}}},
+		{"no name", RouteMatch{Headers: []ValueMatch{{Value: "true"}}}},
+		{"value and regex", RouteMatch{Query: []ValueMatch{{Name: "q", Value: "1", Regex: "1"}}}},
+		{"bad regex", RouteMatch{Cookies: []ValueMatch{{Name: "c", Regex: "(("}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			config := Config{Routes: Routes{{Path: "/", Match: &tt.m}}}
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			config.compileRouteMatches()
+		})
+	}
+}
+
+func TestRouteSortingPrefersMoreSpecificMatch(t *testing.T) {
+	canary := &RouteMatch{Headers: []ValueMatch{{Name: "X-Canary", Value: "true"}}}
+	for _, routes := range []Routes{
+		{
+			{Path: "/api", PathType: prefixS, Resource: "stable"},
+			{Path: "/api", PathType: prefixS, Resource: "canary", Match: canary},
+			{Path: "/api/v2", PathType: prefixS, Resource: "v2"},
+		},
+		{
+			{Path: "/api", PathType: prefixS, Resource: "canary", Match: canary},
+			{Path: "/api/v2", PathType: prefixS, Resource: "v2"},
+			{Path: "/api", PathType: prefixS, Resource: "stable"},
+			{Path: "/", PathType: prefixS, Resource: "root"},
+		},
+	} {
+		sort.Sort(routes)
+		want := []string{"v2", "canary", "stable"}
+		for i, w := range want {
+			if routes[i].Resource != w {
+				t.Errorf("want route %d to be %s, got %s", i, w, routes[i].Resource)
+			}
+		}
+	}
+}
+
+func TestMatchRoutesCanaryByHeader(t *testing.T) {
+	Runner = mockRuntime()
+	canary := Route{Path: "/", PathType: prefixS, Resource: "canary", Match: &RouteMatch{Headers: []ValueMatch{{Name: "X-Canary", Value: "true"}}}}
+	canary.compilePath()
+	canary.Match.compile()
+	Runner.Routes = append(Routes{canary}, Runner.Routes...)
+	Runner.routeMatcher = NewRouteMatcher(Runner.Routes)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	proxy := &Proxy{}
+	if !matchRoutes(req, proxy) || proxy.Route.Resource == "canary" {
+		t.Errorf("request without header should not match canary route")
+	}
+
+	req.Header.Set("X-Canary", "true")
+	proxy = &Proxy{}
+	if !matchRoutes(req, proxy) || proxy.Route.Resource != "canary" {
+		t.Errorf("request with header should match canary route")
+	}
+}
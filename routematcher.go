@@ -0,0 +1,171 @@
+package j8a
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// RouteMatcher finds the first route in sort order that matches a request. A host trie and radix trees over the
+// literal prefix of each route path narrow down the candidates, so only few routes run their regexes instead of all.
+type RouteMatcher struct {
+	routes Routes
+	hosts  *hostNode
+	any    *radixNode
+}
+
+// hostNode is a trie of DNS labels from the top level domain down. Wildcard hosts are stored under a "*" label.
+type hostNode struct {
+	children map[string]*hostNode
+	paths    *radixNode
+}
+
+// radixNode is a radix tree of route path literal prefixes. Children never share a first byte.
+type radixNode struct {
+	prefix   string
+	routes   []int
+	children []*radixNode
+}
+
+// NewRouteMatcher indexes sorted and compiled routes.
+func NewRouteMatcher(routes Routes) *RouteMatcher {
+	m := &RouteMatcher{
+		routes: routes,
+		hosts:  &hostNode{},
+		any:    &radixNode{},
+	}
+	for i := range routes {
+		//the literal prefix must begin any match of the path regex
+		prefix, _ := routes[i].CompiledPathRegex.LiteralPrefix()
+		paths := m.any
+		if len(routes[i].PunyHost) > 0 {
+			paths = m.hosts.insert(hostLabels(routes[i].PunyHost))
+		}
+		paths.insert(prefix, i)
+	}
+	return m
+}
+
+// match returns the matching route with the lowest index, which is the one a linear scan would find first.
+func (m *RouteMatcher) match(request *http.Request) *Route {
+	if m == nil {
+		return nil
+	}
+	//prefix routes also match the path with a trailing slash
+	path := request.URL.Path
+	if !strings.HasSuffix(path, slashS) {
+		path = path + slashS
+	}
+
+	candidates := m.any.collect(path, nil)
+	for _, paths := range m.hosts.lookup(hostLabels(requestHost(request)), nil) {
+		candidates = paths.collect(path, candidates)
+	}
+	sort.Ints(candidates)
+	for _, i := range candidates {
+		if m.routes[i].match(request) {
+			return &m.routes[i]
+		}
+	}
+	return nil
+}
+
+func requestHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.Host)
+	if err != nil {
+		host = request.Host
+	}
+	al, _ := idna.ToASCII(host)
+	return al
+}
+
+// hostLabels are the lower case DNS labels of host, top level domain first.
+func hostLabels(host string) []string {
+	labels := strings.Split(strings.ToLower(host), dot)
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+func (n *hostNode) insert(labels []string) *radixNode {
+	if len(labels) == 0 {
+		if n.paths == nil {
+			n.paths = &radixNode{}
+		}
+		return n.paths
+	}
+	if n.children == nil {
+		n.children = make(map[string]*hostNode)
+	}
+	c, ok := n.children[labels[0]]
+	if !ok {
+		c = &hostNode{}
+		n.children[labels[0]] = c
+	}
+	return c.insert(labels[1:])
+}
+
+// lookup collects the path trees of hosts matching labels. A "*" label matches any single label.
+func (n *hostNode) lookup(labels []string, found []*radixNode) []*radixNode {
+	if len(labels) == 0 {
+		if n.paths != nil {
+			found = append(found, n.paths)
+		}
+		return found
+	}
+	if c, ok := n.children[labels[0]]; ok {
+		found = c.lookup(labels[1:], found)
+	}
+	if c, ok := n.children[wildcard]; ok && labels[0] != wildcard {
+		found = c.lookup(labels[1:], found)
+	}
+	return found
+}
+
+func (n *radixNode) insert(key string, route int) {
+	if len(key) == 0 {
+		n.routes = append(n.routes, route)
+		return
+	}
+	for _, c := range n.children {
+		l := commonPrefixLen(key, c.prefix)
+		if l == 0 {
+			continue
+		}
+		if l < len(c.prefix) {
+			split := &radixNode{prefix: c.prefix[l:], routes: c.routes, children: c.children}
+			c.prefix, c.routes, c.children = c.prefix[:l], nil, []*radixNode{split}
+		}
+		c.insert(key[l:], route)
+		return
+	}
+	n.children = append(n.children, &radixNode{prefix: key, routes: []int{route}})
+}
+
+// collect appends the routes of all nodes whose key is a prefix of path.
+func (n *radixNode) collect(path string, routes []int) []int {
+	routes = append(routes, n.routes...)
+	for _, c := range n.children {
+		if strings.HasPrefix(path, c.prefix) {
+			return c.collect(path[len(c.prefix):], routes)
+		}
+	}
+	return routes
+}
+
+func commonPrefixLen(a string, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (config Config) compileRouteMatcher() *Config {
+	config.routeMatcher = NewRouteMatcher(config.Routes)
+	return &config
+}
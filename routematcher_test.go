@@ -0,0 +1,106 @@
+package j8a
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func mkMatcherRoutes() Routes {
+	routes := Routes{
+		{Path: "/", PathType: prefixS, Resource: "root"},
+		{Path: "/mse6", PathType: prefixS, Resource: "mse6"},
+		{Path: "/mse6/", PathType: prefixS, Resource: "mse6slash"},
+		{Path: "/mse6/get", PathType: exact, Resource: "mse6get"},
+		{Path: "/a/b/*", PathType: prefixS, Resource: "star"},
+		{Path: "/users/[0-9]+", PathType: regexS, Resource: "users"},
+		{Path: "/a|/b", PathType: regexS, Resource: "alternation"},
+		{Path: "/(?i)caps", PathType: regexS, Resource: "caps"},
+		{Path: "/v1/users/{id}", PathType: prefixS, Resource: "params"},
+		{Path: "/api", PathType: prefixS, Resource: "canary", Match: &RouteMatch{Headers: []ValueMatch{{Name: "X-Canary", Value: "true"}}}},
+		{Path: "/api", PathType: prefixS, Resource: "api"},
+		{Path: "/", PathType: prefixS, Host: "foo.com", Resource: "foo"},
+		{Path: "/mse6", PathType: prefixS, Host: "foo.com", Resource: "foomse6"},
+		{Path: "/", PathType: prefixS, Host: "*.foo.com", Resource: "wildfoo"},
+		{Path: "/x", PathType: exact, Host: "bar.foo.com", Resource: "barfoox"},
+	}
+	for i := range routes {
+		routes[i].compilePath()
+		if len(routes[i].Host) > 0 {
+			routes[i].compileHostPattern()
+		}
+		if routes[i].Match != nil {
+			routes[i].Match.compile()
+		}
+	}
+	sort.Sort(routes)
+	return routes
+}
+
+func linearMatch(routes Routes, args ...string) string {
+	req := requestFactory(args...)
+	for _, route := range routes {
+		if route.match(req) {
+			return route.Resource
+		}
+	}
+	return ""
+}
+
+func TestRouteMatcherAgreesWithLinearScan(t *testing.T) {
+	routes := mkMatcherRoutes()
+	m := NewRouteMatcher(routes)
+
+	var tests = [][]string{
+		{"/"}, {"/mse6"}, {"/mse6/"}, {"/mse6/get"}, {"/mse6/get/"}, {"/mse6/put"}, {"/mse7"},
+		{"/a/b"}, {"/a/b/c"}, {"/a"}, {"/b"}, {"/c"}, {"/CAPS"}, {"/caps"},
+		{"/users/42"}, {"/users/42/orders"}, {"/users/x"},
+		{"/v1/users/42"}, {"/v1/users/42/orders"}, {"/v1/users/"},
+		{"/api"}, {"/api/v2"},
+		{"/", "foo.com"}, {"/mse6", "foo.com"}, {"/mse6", "foo.com:8080"}, {"/mse6/get", "foo.com"},
+		{"/", "bar.foo.com"}, {"/x", "bar.foo.com"}, {"/y", "baz.foo.com"}, {"/", "a.bar.foo.com"},
+		{"/", "other.com"}, {"/mse6", "FOO.com"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt), func(t *testing.T) {
+			want := linearMatch(routes, tt...)
+			got := ""
+			if r := m.match(requestFactory(tt...)); r != nil {
+				got = r.Resource
+			}
+			if got != want {
+				t.Errorf("matcher should agree with linear scan, want %s, got %s", want, got)
+			}
+		})
+	}
+
+	req := requestFactory("/api")
+	req.Header.Set("X-Canary", "true")
+	if r := m.match(req); r == nil || r.Resource != "canary" {
+		t.Errorf("matcher should honour match criteria")
+	}
+}
+
+func TestNilRouteMatcherMatchesNothing(t *testing.T) {
+	var none *RouteMatcher
+	if none.match(requestFactory("/")) != nil {
+		t.Errorf("nil matcher should not match")
+	}
+}
+
+func TestRadixNodeSplitsPrefixes(t *testing.T) {
+	root := &radixNode{}
+	root.insert("/mse6/get", 0)
+	root.insert("/mse6/put", 1)
+	root.insert("/mse", 2)
+	root.insert("", 3)
+
+	got := root.collect("/mse6/get/", nil)
+	sort.Ints(got)
+	if fmt.Sprint(got) != "[0 2 3]" {
+		t.Errorf("want routes [0 2 3], got %v", got)
+	}
+	if got = root.collect("/other", nil); fmt.Sprint(got) != "[3]" {
+		t.Errorf("want routes [3], got %v", got)
+	}
+}
@@ -1,7 +1,9 @@
 package j8a
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -14,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,18 +31,53 @@ var ID string = "unknown"
 // Runtime struct defines runtime environment wrapper for a config.
 type Runtime struct {
 	Config
-	Start             time.Time
-	StateHandler      *StateHandler
-	Memory            []sample
-	AcmeHandler       *AcmeHandler
-	ReloadableCert    *ReloadableCert
-	cacheDir          string
-	ConnectionWatcher ConnectionWatcher
+	Start               time.Time
+	StateHandler        *StateHandler
+	Memory              []sample
+	AcmeHandler         *AcmeHandler
+	ReloadableCert      *ReloadableCert
+	HealthChecks        *HealthChecks
+	CircuitBreakers     *CircuitBreakers
+	Outliers            *Outliers
+	Tracer              *Tracer
+	Reloader            *Reloader
+	Drainer             *Drainer
+	RateLimitStore      RateLimitStore
+	ConcurrencyLimiters *ConcurrencyLimiters
+	cacheDir            string
+	ConnectionWatcher   *ConnectionWatcher
 }
 
-// Runner is the Live environment of the server
+// Runner is the environment the server booted with. Config reloads don't write it, use currentRuntime() for the
+// live environment
 var Runner *Runtime
 
+// liveRuntime is the Runtime of the last successful config reload, nil until the first reload
+var liveRuntime atomic.Pointer[Runtime]
+
+// currentRuntime is the live environment of the server. Handlers load it once per request, see withRuntime.
+func currentRuntime() *Runtime {
+	if rt := liveRuntime.Load(); rt != nil {
+		return rt
+	}
+	return Runner
+}
+
+type runtimeKey struct{}
+
+// withRuntime pins the Runtime to the request so all of its handlers see the same config during a reload.
+func withRuntime(r *http.Request, rt *Runtime) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), runtimeKey{}, rt))
+}
+
+// requestRuntime is the Runtime pinned to the request, or the live one if none was pinned.
+func requestRuntime(r *http.Request) *Runtime {
+	if rt, ok := r.Context().Value(runtimeKey{}).(*Runtime); ok {
+		return rt
+	}
+	return currentRuntime()
+}
+
 const tlsHandshakeError = "TLS handshake error"
 const aboutPath = "/about"
 const UpgradeHeader = "Upgrade"
@@ -81,7 +119,9 @@ func BootStrap() {
 		Config:            *config,
 		Start:             time.Now(),
 		AcmeHandler:       NewAcmeHandler(),
-		ConnectionWatcher: ConnectionWatcher{dwnOpenConns: 0},
+		ConnectionWatcher: &ConnectionWatcher{dwnOpenConns: 0},
+		Reloader:          NewReloader(),
+		Drainer:           NewDrainer(),
 	}
 
 	Runner.
@@ -89,6 +129,13 @@ func BootStrap() {
 		initReloadableCert().
 		initStats().
 		initUserAgent().
+		initHealthChecks().
+		initCircuitBreakers().
+		initOutliers().
+		initRateLimitStore().
+		initConcurrencyLimiters().
+		initTracer().
+		initReloader().
 		resetLogLevel().
 		startListening()
 }
@@ -105,7 +152,13 @@ func ShutDown() {
 
 func processConfig() *Config {
 	initLogger()
+	config := loadConfig()
+	config.applyTimeZone()
+	return config
+}
 
+// loadConfig runs the whole validation chain. It panics for invalid config.
+func loadConfig() *Config {
 	config := new(Config).
 		load().
 		validateTimeZone().
@@ -113,17 +166,27 @@ func processConfig() *Config {
 		reformatResourceUrlSchemes().
 		reApplyResourceURLDefaults().
 		validateResources().
+		validateHealthChecks().
+		validateLoadBalancing().
+		validateConcurrency().
 		reApplyResourceNames().
 		validateJwt().
 		compileRoutePaths().
 		compileRouteHosts().
 		compileRouteTransforms().
+		compileRouteMatches().
 		validateRoutes().
+		validateRateLimits().
+		validateIPFilters().
+		validateHeaderRules().
+		compileRouteMatcher().
 		addDefaultPolicy().
 		setDefaultUpstreamParams().
 		setDefaultDownstreamParams().
 		validateHTTPConfig().
-		validateAcmeConfig()
+		validateAcmeConfig().
+		validateTracing().
+		validateReload()
 	return config
 }
 
@@ -148,32 +211,11 @@ func (r *Runtime) initCacheDir() *Runtime {
 }
 
 func (rt *Runtime) resetLogLevel() *Runtime {
-	logLevel := strings.ToUpper(rt.Config.LogLevel)
-	old := strings.ToUpper(zerolog.GlobalLevel().String())
-
 	//this should be async so we never get stuck waiting for resetting log level.
 	go func() {
 		//this will wait until start listening is giving us Daemon state
 		rt.StateHandler.waitState(Daemon)
-		if len(logLevel) > 0 && logLevel != old {
-			switch logLevel {
-			case "TRACE":
-				log.Info().Msgf("resetting global log level to %v", logLevel)
-				zerolog.SetGlobalLevel(zerolog.TraceLevel)
-
-			case "DEBUG":
-				log.Info().Msgf("resetting global log level to %v", logLevel)
-				zerolog.SetGlobalLevel(zerolog.DebugLevel)
-
-			case "INFO":
-				zerolog.SetGlobalLevel(zerolog.InfoLevel)
-				log.Info().Msgf("resetting global log level to %v", logLevel)
-
-			case "WARN":
-				log.Info().Msgf("resetting global log level to %v", logLevel)
-				zerolog.SetGlobalLevel(zerolog.WarnLevel)
-			}
-		}
+		rt.Config.applyLogLevel()
 	}()
 	return rt
 }
@@ -193,10 +235,10 @@ func (r *Runtime) initReloadableCert() *Runtime {
 }
 
 func (rt *Runtime) startListening() {
-	readTimeoutDuration := time.Second * time.Duration(rt.Connection.Downstream.ReadTimeoutSeconds)
-	roundTripTimeoutDuration := time.Second * time.Duration(rt.Connection.Downstream.RoundTripTimeoutSeconds)
+	readTimeoutDuration := rt.Connection.Downstream.readTimeoutDuration()
+	roundTripTimeoutDuration := rt.Connection.Downstream.roundTripTimeoutDuration()
 	roundTripTimeoutDurationWithGrace := roundTripTimeoutDuration + (time.Second * 1)
-	idleTimeoutDuration := time.Second * time.Duration(rt.Connection.Downstream.IdleTimeoutSeconds)
+	idleTimeoutDuration := rt.Connection.Downstream.idleTimeoutDuration()
 
 	log.Info().
 		Int64("dwnMaxBodyBytes", rt.Connection.Downstream.MaxBodyBytes).
@@ -223,36 +265,55 @@ func (rt *Runtime) startListening() {
 	msg := fmt.Sprintf("j8a %s listener(s) init on", Version)
 	if rt.isHTTPOn() {
 		h := msg + fmt.Sprintf(" HTTP:%d...", rt.Connection.Downstream.Http.Port)
+		rt.Drainer.register(httpConfig)
 		go rt.startHTTP(httpConfig, err, h)
 	}
 	if rt.isTLSOn() {
 		t := msg + fmt.Sprintf(" TLS:%d...", rt.Connection.Downstream.Tls.Port)
 		tlsConfig := *httpConfig
 		tlsConfig.Addr = ":" + strconv.Itoa(rt.Connection.Downstream.Tls.Port)
+		rt.Drainer.register(&tlsConfig)
 		go rt.startTls(&tlsConfig, err, t)
 	}
+	if rt.hasMetricsListener() {
+		metricsConfig := &http.Server{
+			Addr:              ":" + strconv.Itoa(rt.Connection.Downstream.Metrics.Port),
+			ReadHeaderTimeout: readTimeoutDuration,
+			ReadTimeout:       readTimeoutDuration,
+			WriteTimeout:      roundTripTimeoutDurationWithGrace,
+			IdleTimeout:       idleTimeoutDuration,
+			ErrorLog:          golog.New(&zerologAdapter{}, "", 0),
+			Handler:           MetricsDelegate{},
+		}
+		rt.Drainer.register(metricsConfig)
+		go rt.startMetrics(metricsConfig, err)
+	}
 
-	select {
-	case sig := <-err:
-		panic(sig.Error())
+	for {
+		//listeners closed by graceful shutdown are not an error, the drain decides when we exit.
+		if sig := <-err; !errors.Is(sig, http.ErrServerClosed) {
+			panic(sig.Error())
+		}
 	}
 }
 
 type HandlerDelegate struct{}
 
-// TODO regex and perftest this function.
 var acmeRex, _ = regexp.Compile("/.well-known/acme-challenge/")
 var aboutRex, _ = regexp.Compile("^" + aboutPath + "$")
+var metricsRex, _ = regexp.Compile("^" + metricsPath + "$")
 
 const star = "*"
 const options = "OPTIONS"
 
 func (hd HandlerDelegate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if Runner.AcmeHandler.isActive() &&
+	rt := currentRuntime()
+	r = withRuntime(r, rt)
+	if rt.AcmeHandler.isActive() &&
 		acmeRex.MatchString(r.RequestURI) {
 		acmeHandler(w, r)
-	} else if Runner.isHTTPOn() &&
-		Runner.Connection.Downstream.Http.Redirecttls &&
+	} else if rt.isHTTPOn() &&
+		rt.Connection.Downstream.Http.Redirecttls &&
 		r.TLS == nil {
 		redirectHandler(w, r)
 	} else if r.ProtoMajor == 1 && r.Header.Get(UpgradeHeader) == websocket {
@@ -260,6 +321,12 @@ func (hd HandlerDelegate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		//TODO: this does not resolve whether about was actually configured in routes.
 	} else if aboutRex.MatchString(r.RequestURI) {
 		aboutHandler(w, r)
+	} else if rt.isProbe(rt.Connection.Downstream.Probes.LivenessPath, r) {
+		livenessHandler(w, r)
+	} else if rt.isProbe(rt.Connection.Downstream.Probes.ReadinessPath, r) {
+		readinessHandler(w, r)
+	} else if rt.hasDownstreamMetrics() && metricsRex.MatchString(r.RequestURI) {
+		metricsHandler(w, r)
 	} else if star == r.RequestURI && options == strings.ToUpper(r.Method) {
 		globalOptionsHandler(w, r)
 	} else {
@@ -12,17 +12,20 @@ type State string
 const (
 	Bootstrap State = "Bootstrap"
 	Daemon    State = "Daemon"
+	Draining  State = "Draining"
 	Shutdown  State = "Shutdown"
 )
 
+// stateOrder is the lifecycle of the server, states only ever move forward.
+var stateOrder = map[State]int{
+	Bootstrap: 0,
+	Daemon:    1,
+	Draining:  2,
+	Shutdown:  3,
+}
+
 func (s State) Lesser(t State) bool {
-	if s == Bootstrap && (t == Daemon || t == Shutdown) {
-		return true
-	}
-	if s == Daemon && t == Shutdown {
-		return true
-	}
-	return false
+	return stateOrder[s] < stateOrder[t]
 }
 
 type StateHandler struct {
@@ -58,6 +61,14 @@ func (sh *StateHandler) waitState(s State, timeoutSeconds ...int) {
 	}
 }
 
+// current is the state of the server, empty if there is no StateHandler.
+func (sh *StateHandler) current() State {
+	if sh == nil {
+		return ""
+	}
+	return sh.Current
+}
+
 func (sh *StateHandler) setState(s State) {
 	// == matters because we may want to retrigger the state for waiting goroutines.
 	if sh.Current == s || sh.Current.Lesser(s) {
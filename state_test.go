@@ -21,6 +21,11 @@ func TestStateLesser(t *testing.T) {
 		{n: "Shutdown not lesser Daemon", a: Shutdown, b: Daemon, v: false},
 		{n: "Shutdown not lesser Bootstrap", a: Shutdown, b: Bootstrap, v: false},
 		{n: "Shutdown not lesser Shutdown", a: Shutdown, b: Shutdown, v: false},
+		{n: "Daemon lesser Draining", a: Daemon, b: Draining, v: true},
+		{n: "Draining lesser Shutdown", a: Draining, b: Shutdown, v: true},
+		{n: "Draining not lesser Daemon", a: Draining, b: Daemon, v: false},
+		{n: "Draining not lesser Draining", a: Draining, b: Draining, v: false},
+		{n: "Shutdown not lesser Draining", a: Shutdown, b: Draining, v: false},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +103,10 @@ func TestStateHandlerSetStateAndWaitForStatus(t *testing.T) {
 		{"SSB", Shutdown, Shutdown, Bootstrap, false},
 		{"SSD", Shutdown, Shutdown, Daemon, false},
 		{"SSS", Shutdown, Shutdown, Shutdown, false},
+		{"DXD", Daemon, Draining, Daemon, false},
+		{"DXX", Daemon, Draining, Draining, false},
+		{"DXS", Daemon, Draining, Shutdown, true},
+		{"XSX", Draining, Shutdown, Draining, false},
 	}
 
 	for _, tt := range tests {
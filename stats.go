@@ -28,6 +28,9 @@ type sample struct {
 	dwnMaxOpenTcpConns uint64
 	upOpenTcpConns     uint64
 	upMaxOpenTcpConns  uint64
+	upInFlight         uint64
+	upQueued           uint64
+	upShed             uint64
 	threads            int
 	ulimit             uint64
 }
@@ -58,6 +61,9 @@ const pidDwnOpenTcpConns = "pidDwnOpenTcpConns"
 const pidDwnMaxOpenTcpConns = "pidDwnMaxOpenTcpConns"
 const pidUpOpenTcpConns = "pidUpOpenTcpConns"
 const pidUpMaxOpenTcpConns = "pidUpMaxOpenTcpConns"
+const pidUpInFlightRequests = "pidUpInFlightRequests"
+const pidUpQueuedRequests = "pidUpQueuedRequests"
+const pidUpShedRequests = "pidUpShedRequests"
 const pidOSThreads = "pidOSThreads"
 const pidOSUlimit = "pidOSUlimit"
 const serverPerformance = "server performance"
@@ -74,6 +80,9 @@ func (s sample) log() {
 		Uint64(pidDwnMaxOpenTcpConns, s.dwnMaxOpenTcpConns).
 		Uint64(pidUpOpenTcpConns, s.upOpenTcpConns).
 		Uint64(pidUpMaxOpenTcpConns, s.upMaxOpenTcpConns).
+		Uint64(pidUpInFlightRequests, s.upInFlight).
+		Uint64(pidUpQueuedRequests, s.upQueued).
+		Uint64(pidUpShedRequests, s.upShed).
 		Uint64(pidRssBytes, s.rssBytes).
 		Uint64(pidVmsBytes, s.vmsBytes).
 		Uint64(pidSwapBytes, s.swapBytes).
@@ -150,6 +159,7 @@ func (rt *Runtime) getSample(proc *process.Process) sample {
 	_ = cs
 
 	procStatsLock.Unlock()
+	inFlight, queued, shed := rt.ConcurrencyLimiters.totals()
 	return sample{
 		pid:                proc.Pid,
 		cpuPc:              cpuPc,
@@ -162,6 +172,9 @@ func (rt *Runtime) getSample(proc *process.Process) sample {
 		dwnMaxOpenTcpConns: rt.ConnectionWatcher.DwnMaxCount(),
 		upOpenTcpConns:     rt.ConnectionWatcher.UpCount(),
 		upMaxOpenTcpConns:  rt.ConnectionWatcher.UpMaxCount(),
+		upInFlight:         inFlight,
+		upQueued:           queued,
+		upShed:             shed,
 		threads:            threadProfile.Count(),
 		ulimit:             ulimit,
 	}
@@ -216,7 +229,9 @@ func (rt *Runtime) LookUpResourceIps() map[string][]net.IP {
 func (rt *Runtime) logRuntimeStats(proc *process.Process) {
 	go func() {
 		for {
-			rt.getSample(proc).log()
+			s := rt.getSample(proc)
+			lastSample.Store(&s)
+			s.log()
 			time.Sleep(time.Second * logSamplerSleepSeconds)
 		}
 	}()
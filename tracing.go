@@ -0,0 +1,513 @@
+package j8a
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Tracing params export spans of W3C trace context to an OpenTelemetry collector via OTLP/HTTP.
+type Tracing struct {
+	// CollectorURL is the OTLP/HTTP traces endpoint, i.e. http://localhost:4318/v1/traces
+	CollectorURL string
+
+	// ServiceName is reported as service.name of all spans. Defaults to j8a
+	ServiceName string
+
+	// BatchSize is the maximum number of spans per export request. Defaults to 512
+	BatchSize int
+
+	// ExportIntervalSeconds is the maximum wait before a partial batch is exported. Defaults to 5
+	ExportIntervalSeconds int
+
+	// ExportInterval is ExportIntervalSeconds as a duration. Takes precedence over ExportIntervalSeconds.
+	ExportInterval Duration
+}
+
+func (tr Tracing) exportIntervalDuration() time.Duration {
+	return durationOrSeconds(tr.ExportInterval, tr.ExportIntervalSeconds)
+}
+
+const traceparentHeader = "Traceparent"
+const tracestateHeader = "Tracestate"
+const traceVersion = "00"
+const traceFlagSampled byte = 0x01
+
+const logTraceID = "traceId"
+const logSpanID = "spanId"
+
+const downstreamRequestSpan = "downstream request"
+const routeMatchSpan = "route match"
+const jwtValidationSpan = "jwt validation"
+const upstreamAttemptSpan = "upstream attempt"
+
+const tracerStarted = "tracing exporter started for collector %s"
+const tracerQueueFull = "tracing exporter queue full, span dropped"
+const tracerExportFailed = "tracing exporter failed to export %d spans, cause: %v"
+const tracerExportRejected = "tracing exporter spans rejected by collector with status %d"
+
+// span kinds and status codes as defined by OTLP.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+type traceID [16]byte
+type spanID [8]byte
+
+func (t traceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t traceID) isZero() bool {
+	return t == traceID{}
+}
+
+func (s spanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s spanID) isZero() bool {
+	return s == spanID{}
+}
+
+// traceContext is the W3C trace context of a downstream request.
+type traceContext struct {
+	traceID  traceID
+	parentID spanID
+	flags    byte
+	state    string
+}
+
+func (tc *traceContext) isSampled() bool {
+	return tc.flags&traceFlagSampled == traceFlagSampled
+}
+
+// parseTraceparent reads a W3C traceparent header value. Returns false for malformed values, all zero ids and the
+// reserved version ff.
+func parseTraceparent(value string) (*traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	if parts[0] == "ff" || (parts[0] == traceVersion && len(parts) != 4) {
+		return nil, false
+	}
+	for _, p := range parts[:4] {
+		if p != strings.ToLower(p) {
+			return nil, false
+		}
+	}
+
+	tc := &traceContext{}
+	var flags [1]byte
+	if _, err := hex.Decode(tc.traceID[:], []byte(parts[1])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(tc.parentID[:], []byte(parts[2])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return nil, false
+	}
+	if tc.traceID.isZero() || tc.parentID.isZero() {
+		return nil, false
+	}
+	tc.flags = flags[0]
+	return tc, true
+}
+
+func newTraceID() traceID {
+	var t traceID
+	for t.isZero() {
+		rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() spanID {
+	var s spanID
+	for s.isZero() {
+		rand.Read(s[:])
+	}
+	return s
+}
+
+type spanAttribute struct {
+	key   string
+	value interface{}
+}
+
+// span is one timed operation of a trace. Methods are safe to call on nil spans of untraced requests.
+type span struct {
+	tc         *traceContext
+	tracer     *Tracer
+	spanID     spanID
+	parentID   spanID
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []spanAttribute
+	status     int
+	message    string
+}
+
+func (sp *span) setStr(key string, value string) *span {
+	if sp != nil {
+		sp.attributes = append(sp.attributes, spanAttribute{key, value})
+	}
+	return sp
+}
+
+func (sp *span) setInt(key string, value int) *span {
+	if sp != nil {
+		sp.attributes = append(sp.attributes, spanAttribute{key, value})
+	}
+	return sp
+}
+
+func (sp *span) setError(message string) *span {
+	if sp != nil {
+		sp.status = spanStatusError
+		sp.message = message
+	}
+	return sp
+}
+
+// finish ends the span once and hands sampled spans to the exporter.
+func (sp *span) finish() {
+	if sp == nil || !sp.end.IsZero() {
+		return
+	}
+	sp.end = time.Now()
+	if sp.tc.isSampled() {
+		sp.tracer.enqueue(sp)
+	}
+}
+
+func (sp *span) traceparent() string {
+	return traceVersion + "-" + sp.tc.traceID.String() + "-" + sp.spanID.String() + "-" + hex.EncodeToString([]byte{sp.tc.flags})
+}
+
+// startTrace continues the trace of the downstream traceparent, or starts a new one if a tracer is configured, and
+// opens the server span. Requests are not traced without either.
+func (proxy *Proxy) startTrace(request *http.Request) {
+	var tracer *Tracer
+	if rt := proxy.runtime(); rt != nil {
+		tracer = rt.Tracer
+	}
+	tc, ok := parseTraceparent(request.Header.Get(traceparentHeader))
+	if ok {
+		tc.state = request.Header.Get(tracestateHeader)
+	} else if tracer != nil {
+		tc = &traceContext{traceID: newTraceID(), flags: traceFlagSampled}
+	} else {
+		return
+	}
+	proxy.trace = tc
+	proxy.span = &span{
+		tc:       tc,
+		tracer:   tracer,
+		spanID:   newSpanID(),
+		parentID: tc.parentID,
+		name:     downstreamRequestSpan,
+		kind:     spanKindServer,
+		start:    proxy.Dwn.startDate,
+	}
+}
+
+// startSpan opens a child span of the downstream request span. Returns nil if the request is not traced.
+func (proxy *Proxy) startSpan(name string, kind int) *span {
+	if proxy.span == nil {
+		return nil
+	}
+	return &span{
+		tc:       proxy.trace,
+		tracer:   proxy.span.tracer,
+		spanID:   newSpanID(),
+		parentID: proxy.span.spanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+}
+
+// finishTrace ends the downstream request span with the served status code.
+func (proxy *Proxy) finishTrace() {
+	if proxy.span == nil {
+		return
+	}
+	route, resource := proxy.routeLabels()
+	proxy.span.setStr("http.request.method", proxy.Dwn.Method).
+		setStr("url.path", proxy.Dwn.Path).
+		setStr("http.route", route).
+		setStr("j8a.resource", resource).
+		setStr("j8a.x_request_id", proxy.XRequestID).
+		setInt("http.response.status_code", proxy.Dwn.Resp.StatusCode)
+	if proxy.Dwn.Resp.StatusCode >= 500 {
+		proxy.span.setError(proxy.Dwn.Resp.Message)
+	}
+	proxy.span.finish()
+}
+
+// setTraceHeaders propagates the trace context upstream with the span of the current attempt as parent.
+func (proxy *Proxy) setTraceHeaders(header http.Header, sp *span) {
+	if sp == nil {
+		return
+	}
+	header.Set(traceparentHeader, sp.traceparent())
+	if len(sp.tc.state) > 0 {
+		header.Set(tracestateHeader, sp.tc.state)
+	}
+}
+
+// finishUnsuccessfulAttemptSpan ends the span of the current attempt with the upstream error or status code.
+func (proxy *Proxy) finishUnsuccessfulAttemptSpan(upstreamResponse *http.Response, upstreamError error) {
+	sp := proxy.Up.Atmpt.span
+	if upstreamResponse != nil && upstreamResponse.StatusCode > 0 {
+		sp.setInt("http.response.status_code", upstreamResponse.StatusCode)
+	}
+	if upstreamError != nil {
+		sp.setError(upstreamError.Error())
+	} else if proxy.Up.Atmpt.AbortedFlag {
+		sp.setError(upstreamReqAborted)
+	} else {
+		sp.setError(http.StatusText(proxy.Up.Atmpt.StatusCode))
+	}
+	sp.finish()
+}
+
+// withTrace adds the trace id, and the span id of the current upstream attempt, to log events of traced requests.
+func (proxy *Proxy) withTrace(ev *zerolog.Event) *zerolog.Event {
+	if proxy.trace != nil {
+		ev = ev.Str(logTraceID, proxy.trace.traceID.String())
+	}
+	if proxy.Up.Atmpt != nil && proxy.Up.Atmpt.span != nil {
+		ev = ev.Str(logSpanID, proxy.Up.Atmpt.span.spanID.String())
+	}
+	return ev
+}
+
+// Tracer batches finished spans and exports them to the collector.
+type Tracer struct {
+	params Tracing
+	client *http.Client
+	queue  chan *span
+	flush  chan chan struct{}
+	once   sync.Once
+}
+
+// NewTracer creates the exporter for validated Tracing params.
+func NewTracer(params Tracing) *Tracer {
+	return &Tracer{
+		params: params,
+		client: &http.Client{Timeout: params.exportIntervalDuration()},
+		queue:  make(chan *span, params.BatchSize*4),
+		flush:  make(chan chan struct{}),
+	}
+}
+
+func (runtime *Runtime) initTracer() *Runtime {
+	if runtime.Tracing != nil {
+		runtime.Tracer = NewTracer(*runtime.Tracing)
+		runtime.Tracer.start()
+	}
+	return runtime
+}
+
+func (tr *Tracer) start() {
+	tr.once.Do(func() {
+		log.Info().Msgf(tracerStarted, tr.params.CollectorURL)
+		go tr.run()
+	})
+}
+
+// enqueue never blocks the request path, spans are dropped when the exporter falls behind.
+func (tr *Tracer) enqueue(sp *span) {
+	if tr == nil {
+		return
+	}
+	select {
+	case tr.queue <- sp:
+	default:
+		log.Debug().
+			Str(logTraceID, sp.tc.traceID.String()).
+			Msg(tracerQueueFull)
+	}
+}
+
+// Flush exports all queued spans and waits for the export to complete.
+func (tr *Tracer) Flush() {
+	if tr == nil {
+		return
+	}
+	done := make(chan struct{})
+	tr.flush <- done
+	<-done
+}
+
+func (tr *Tracer) run() {
+	ticker := time.NewTicker(tr.params.exportIntervalDuration())
+	defer ticker.Stop()
+
+	batch := make([]*span, 0, tr.params.BatchSize)
+	for {
+		select {
+		case sp := <-tr.queue:
+			batch = append(batch, sp)
+			if len(batch) >= tr.params.BatchSize {
+				tr.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			tr.export(batch)
+			batch = batch[:0]
+		case done := <-tr.flush:
+		Drain:
+			for {
+				select {
+				case sp := <-tr.queue:
+					batch = append(batch, sp)
+				default:
+					break Drain
+				}
+			}
+			tr.export(batch)
+			batch = batch[:0]
+			close(done)
+		}
+	}
+}
+
+func (tr *Tracer) export(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, _ := json.Marshal(tr.otlpRequest(batch))
+	resp, err := tr.client.Post(tr.params.CollectorURL, applicationJSON, bytes.NewReader(body))
+	if err != nil {
+		log.Warn().Msgf(tracerExportFailed, len(batch), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode > 299 {
+		log.Warn().Msgf(tracerExportRejected, resp.StatusCode)
+	}
+}
+
+// OTLP/HTTP JSON encoding of ExportTraceServiceRequest, see:
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func newOtlpAttribute(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case int:
+		s := strconv.Itoa(v)
+		a.Value.IntValue = &s
+	case string:
+		a.Value.StringValue = &v
+	}
+	return a
+}
+
+func (tr *Tracer) otlpRequest(batch []*span) otlpTraceRequest {
+	spans := make([]otlpSpan, len(batch))
+	for i, sp := range batch {
+		o := otlpSpan{
+			TraceID:           sp.tc.traceID.String(),
+			SpanID:            sp.spanID.String(),
+			TraceState:        sp.tc.state,
+			Name:              sp.name,
+			Kind:              sp.kind,
+			StartTimeUnixNano: strconv.FormatInt(sp.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(sp.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: sp.status, Message: sp.message},
+		}
+		if !sp.parentID.isZero() {
+			o.ParentSpanID = sp.parentID.String()
+		}
+		for _, a := range sp.attributes {
+			o.Attributes = append(o.Attributes, newOtlpAttribute(a.key, a.value))
+		}
+		spans[i] = o
+	}
+
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			newOtlpAttribute("service.name", tr.params.ServiceName),
+			newOtlpAttribute("service.version", Version),
+			newOtlpAttribute("service.instance.id", ID),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: j8a, Version: Version},
+			Spans: spans,
+		}},
+	}}}
+}
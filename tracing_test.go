@@ -0,0 +1,199 @@
+package j8a
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	var tests = []struct {
+		n     string
+		v     string
+		ok    bool
+		flags byte
+	}{
+		{"valid sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, 0x01},
+		{"valid not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, 0x00},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", true, 0x01},
+		{"version 00 with extra field", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", false, 0},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, 0},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, 0},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, 0},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, 0},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, 0},
+		{"short", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false, 0},
+		{"empty", "", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			tc, ok := parseTraceparent(tt.v)
+			if ok != tt.ok {
+				t.Fatalf("want ok %v, got %v", tt.ok, ok)
+			}
+			if ok && tc.flags != tt.flags {
+				t.Errorf("want flags %v, got %v", tt.flags, tc.flags)
+			}
+			if ok && tc.traceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("trace id not parsed, got %v", tc.traceID)
+			}
+		})
+	}
+}
+
+func TestStartTraceContinuesDownstreamTrace(t *testing.T) {
+	Runner = mockRuntime()
+	req, _ := http.NewRequest("GET", "/mse6/get", nil)
+	req.Header.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(tracestateHeader, "congo=t61rcWkgMzE")
+
+	proxy := new(Proxy).parseIncomingHeaders(req)
+	if got := proxy.trace.traceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want downstream trace id, got %v", got)
+	}
+	if got := proxy.span.parentID.String(); got != "00f067aa0ba902b7" {
+		t.Errorf("want downstream span as parent, got %v", got)
+	}
+
+	sp := proxy.startSpan(upstreamAttemptSpan, spanKindClient)
+	header := http.Header{}
+	proxy.setTraceHeaders(header, sp)
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + sp.spanID.String() + "-01"
+	if got := header.Get(traceparentHeader); got != want {
+		t.Errorf("want upstream traceparent %v, got %v", want, got)
+	}
+	if got := header.Get(tracestateHeader); got != "congo=t61rcWkgMzE" {
+		t.Errorf("want tracestate propagated, got %v", got)
+	}
+	if sp.parentID != proxy.span.spanID {
+		t.Errorf("upstream attempt span should be child of downstream request span")
+	}
+}
+
+func TestStartTraceWithoutTracerIsNotTraced(t *testing.T) {
+	Runner = mockRuntime()
+	req, _ := http.NewRequest("GET", "/mse6/get", nil)
+
+	proxy := new(Proxy).parseIncomingHeaders(req)
+	if proxy.trace != nil || proxy.span != nil {
+		t.Errorf("request should not be traced without tracer or downstream traceparent")
+	}
+
+	header := http.Header{}
+	proxy.setTraceHeaders(header, proxy.startSpan(upstreamAttemptSpan, spanKindClient))
+	if got := header.Get(traceparentHeader); len(got) > 0 {
+		t.Errorf("want no upstream traceparent, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ev := logger.Info()
+	proxy.withTrace(ev).Msg("")
+	if strings.Contains(buf.String(), logTraceID) || strings.Contains(buf.String(), logSpanID) {
+		t.Errorf("want no trace ids in log event, got %v", buf.String())
+	}
+}
+
+func TestStartTraceWithTracerIsSampled(t *testing.T) {
+	Runner = mockRuntime()
+	Runner.Tracer = NewTracer(Tracing{CollectorURL: "http://localhost:4318/v1/traces", BatchSize: 10})
+	req, _ := http.NewRequest("GET", "/mse6/get", nil)
+
+	proxy := new(Proxy).parseIncomingHeaders(req)
+	if proxy.trace == nil || proxy.trace.traceID.isZero() {
+		t.Fatalf("want new trace id")
+	}
+	if !proxy.span.parentID.isZero() {
+		t.Errorf("new trace should not have parent span")
+	}
+	if !proxy.trace.isSampled() {
+		t.Errorf("new trace should be sampled with tracer")
+	}
+}
+
+func TestTracerExportsSpansToCollector(t *testing.T) {
+	received := make(chan otlpTraceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get(contentType) != applicationJSON {
+			t.Errorf("unexpected export request %v %v", r.URL.Path, r.Header.Get(contentType))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpTraceRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("export body not OTLP JSON, cause: %v", err)
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	Runner = mockRuntime()
+	Runner.Tracer = NewTracer(Tracing{
+		CollectorURL:          collector.URL + "/v1/traces",
+		ServiceName:           "j8a",
+		BatchSize:             10,
+		ExportIntervalSeconds: 60,
+	})
+	Runner.Tracer.start()
+
+	req, _ := http.NewRequest("GET", "/mse6/get", nil)
+	proxy := new(Proxy).parseIncomingHeaders(req)
+	proxy.Dwn.Resp.StatusCode = 502
+	proxy.startSpan(routeMatchSpan, spanKindInternal).finish()
+	proxy.finishTrace()
+	Runner.Tracer.Flush()
+
+	var export otlpTraceRequest
+	select {
+	case export = <-received:
+	case <-time.After(time.Second * 5):
+		t.Fatal("collector did not receive spans")
+	}
+
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != routeMatchSpan || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Errorf("route match span should be child of downstream request span, got %+v", spans[0])
+	}
+	if spans[1].Name != downstreamRequestSpan || spans[1].Kind != spanKindServer || spans[1].Status.Code != spanStatusError {
+		t.Errorf("unexpected downstream request span %+v", spans[1])
+	}
+	if spans[1].TraceID != proxy.trace.traceID.String() {
+		t.Errorf("want trace id %v, got %v", proxy.trace.traceID, spans[1].TraceID)
+	}
+	if got := *export.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; got != "j8a" {
+		t.Errorf("want service.name j8a, got %v", got)
+	}
+}
+
+func TestValidateTracingDefaults(t *testing.T) {
+	config := Config{Tracing: &Tracing{CollectorURL: "http://localhost:4318/v1/traces"}}
+	config = *config.validateTracing()
+
+	if config.Tracing.ServiceName != "j8a" || config.Tracing.BatchSize != 512 || config.Tracing.ExportIntervalSeconds != 5 {
+		t.Errorf("tracing defaults not applied, got %+v", config.Tracing)
+	}
+}
+
+func TestValidateTracingInvalidCollectorURLFails(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("config did not panic for invalid collector url")
+		} else if !strings.Contains(r.(string), "collectorUrl") {
+			t.Errorf("unexpected panic %v", r)
+		}
+	}()
+
+	config := Config{Tracing: &Tracing{CollectorURL: "localhost:4318"}}
+	config.validateTracing()
+}
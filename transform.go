@@ -0,0 +1,91 @@
+package j8a
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pathParamVar is a named path param like {id}, matching a single path segment.
+var pathParamVar = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// transformVar refers to a path param {id}, a numbered capture group $1 or a named capture group ${id}.
+var transformVar = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([0-9]+)|\$\{([A-Za-z0-9_]+)\}`)
+
+const pathParamGroup = `(?P<$1>[^/]+)`
+const questionMark = "?"
+const ampersand = "&"
+
+// compilePathParams turns {name} path params into named regex groups.
+func compilePathParams(path string) string {
+	return pathParamVar.ReplaceAllString(path, pathParamGroup)
+}
+
+// compileTransform validates references to path params and capture groups in the transform. Transforms of regex
+// routes and routes with params or groups are kept as regexp template in CompiledTransform, others replace the route
+// path prefix.
+func (route *Route) compileTransform() error {
+	route.CompiledTransform = emptyString
+	re := route.CompiledPathRegex
+	refs := transformVar.FindAllStringSubmatch(route.Transform, -1)
+	if len(route.Transform) == 0 || (len(refs) == 0 && re.NumSubexp() == 0 && route.PathType != regexS) {
+		return nil
+	}
+	for _, ref := range refs {
+		name := ref[1] + ref[3]
+		if len(ref[2]) > 0 {
+			name = ref[2]
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n < 1 || n > re.NumSubexp() {
+				return fmt.Errorf("capture group %s not in route path %s", ref[0], route.Path)
+			}
+		} else if re.SubexpIndex(name) < 0 {
+			return fmt.Errorf("path param %s not in route path %s", ref[0], route.Path)
+		}
+	}
+	route.CompiledTransform = transformVar.ReplaceAllStringFunc(route.Transform, func(ref string) string {
+		if strings.HasPrefix(ref, "{") {
+			return "$" + ref
+		}
+		return ref
+	})
+	return nil
+}
+
+// transformURI rewrites the matched part of the request URI path with the transform template. The rest of the path
+// is kept, the query of the template is sent before the downstream query.
+func (route *Route) transformURI(uri string) string {
+	path, query, _ := strings.Cut(uri, questionMark)
+	re := route.CompiledPathRegex
+	m := re.FindStringSubmatchIndex(path)
+	if m == nil && route.PathType == prefixS && !strings.HasSuffix(path, slashS) {
+		path = path + slashS
+		m = re.FindStringSubmatchIndex(path)
+	}
+	if m == nil {
+		return uri
+	}
+
+	tPath, tQuery, _ := strings.Cut(route.CompiledTransform, questionMark)
+	src := path
+	path = string(re.ExpandString(nil, tPath, src, m))
+	if rest := src[m[1]:]; strings.HasSuffix(path, slashS) && strings.HasPrefix(rest, slashS) {
+		path = path + rest[1:]
+	} else {
+		path = path + rest
+	}
+	if len(tQuery) > 0 {
+		tQuery = string(re.ExpandString(nil, tQuery, src, m))
+		if len(query) > 0 {
+			query = tQuery + ampersand + query
+		} else {
+			query = tQuery
+		}
+	}
+	if len(query) > 0 {
+		return path + questionMark + query
+	}
+	return path
+}
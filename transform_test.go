@@ -0,0 +1,103 @@
+package j8a
+
+import (
+	"testing"
+)
+
+func TestCompilePathParams(t *testing.T) {
+	route := Route{Path: "/v1/users/{id}/orders/{orderId}", PathType: prefixS}
+	if err := route.compilePath(); err != nil {
+		t.Fatalf("path should compile, got %v", err)
+	}
+	m := route.CompiledPathRegex.FindStringSubmatch("/v1/users/42/orders/7")
+	if m == nil {
+		t.Fatalf("path should match")
+	}
+	if m[route.CompiledPathRegex.SubexpIndex("id")] != "42" || m[route.CompiledPathRegex.SubexpIndex("orderId")] != "7" {
+		t.Errorf("want path params 42 and 7, got %v", m)
+	}
+	if route.CompiledPathRegex.MatchString("/v1/users/orders/7") {
+		t.Errorf("path param should not match empty segment")
+	}
+}
+
+func TestTransformURI(t *testing.T) {
+	var tests = []struct {
+		n         string
+		path      string
+		pathType  string
+		transform string
+		uri       string
+		want      string
+	}{
+		{"path param to query", "/v1/users/{id}/orders", prefixS, "/orders?user={id}", "/v1/users/42/orders", "/orders?user=42"},
+		{"keeps downstream query", "/v1/users/{id}/orders", prefixS, "/orders?user={id}", "/v1/users/42/orders?page=2", "/orders?user=42&page=2"},
+		{"keeps rest of path", "/v1/users/{id}/orders", prefixS, "/orders?user={id}", "/v1/users/42/orders/7", "/orders/7?user=42"},
+		{"exact", "/v1/users/{id}", exact, "/users/{id}/profile", "/v1/users/42", "/users/42/profile"},
+		{"numbered group", "/api/(v[0-9])/(.*)", prefixS, "/$2/$1", "/api/v2/items", "/items/v2"},
+		{"named group", "/api/(?P<ver>v[0-9])/", prefixS, "/${ver}/", "/api/v2/items", "/v2/items"},
+		{"plain transform on params route", "/v1/users/{id}", prefixS, "/users", "/v1/users/42/orders", "/users/orders"},
+		{"root transform", "/v1/users/{id}", prefixS, "/", "/v1/users/42/orders", "/orders"},
+		{"no match", "/v1/users/{id}", exact, "/users/{id}", "/other", "/other"},
+		{"regex named group", "/v1/users/(?P<id>[0-9]+)/orders", regexS, "/orders?user={id}", "/v1/users/42/orders?page=2", "/orders?user=42&page=2"},
+		{"regex without groups", "/v1/.*", regexS, "/v2", "/v1/users/42", "/v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			route := Route{Path: tt.path, PathType: tt.pathType, Transform: tt.transform}
+			route.compilePath()
+			if err := route.compileTransform(); err != nil {
+				t.Fatalf("transform should compile, got %v", err)
+			}
+			if got := route.transformURI(tt.uri); got != tt.want {
+				t.Errorf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileTransformPlainKeepsPrefixReplace(t *testing.T) {
+	route := Route{Path: "/mse6", PathType: prefixS, Transform: "/mse7"}
+	route.compilePath()
+	route.compileTransform()
+	if len(route.CompiledTransform) > 0 {
+		t.Errorf("plain transform should not be compiled, got %s", route.CompiledTransform)
+	}
+}
+
+func TestCompileRouteTransformsFails(t *testing.T) {
+	var tests = []struct {
+		n         string
+		path      string
+		transform string
+	}{
+		{"unknown path param", "/v1/users/{id}", "/users/{userId}"},
+		{"unknown named group", "/v1/users/{id}", "/users/${userId}"},
+		{"capture group out of range", "/v1/(.*)", "/$2"},
+		{"capture group zero", "/v1/(.*)", "/$0"},
+		{"no leading slash", "/v1/users/{id}", "users/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			route := Route{Path: tt.path, PathType: prefixS, Transform: tt.transform}
+			route.compilePath()
+			config := Config{Routes: Routes{route}}
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("config should have panicked")
+				}
+			}()
+			config.compileRouteTransforms()
+		})
+	}
+}
+
+func TestResolveUpstreamURIWithPathParams(t *testing.T) {
+	p := mockProxy(make([]byte, 1), "", "/v1/users/{id}/orders", "/orders?user={id}", "/v1/users/42/orders?page=2", "", "")
+	p.Route.compilePath()
+	p.Route.compileTransform()
+	want := "http://upstreamhost:8080/orders?user=42&page=2"
+	if got := p.resolveUpstreamURI(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
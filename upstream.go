@@ -17,6 +17,14 @@ func (u URL) String() string {
 	return u.Scheme + "://" + u.Host + ":" + u.Port
 }
 
+// isUpstreamAvailable tells if the URL may be chosen for upstream attempts, it must pass active health checks,
+// must not have an open circuit breaker and must not be ejected as an outlier.
+func (runtime *Runtime) isUpstreamAvailable(u URL) bool {
+	return runtime.HealthChecks.isHealthy(u) &&
+		runtime.CircuitBreakers.isAvailable(u) &&
+		!runtime.Outliers.isEjected(u)
+}
+
 func (u *URL) UnmarshalJSON(data []byte) error {
 	var value interface{}
 	if err := json.Unmarshal(data, &value); err != nil {
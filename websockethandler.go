@@ -73,7 +73,7 @@ const upWebsocketConnectionFailed = "upstream websocket connection failed"
 const websocketUnspecifiedNetworkEvent = " websocket unspecified network event: %s"
 const upWebsocketUnspecifiedNetworkEvent = "upstream" + websocketUnspecifiedNetworkEvent
 const dwnWebsocketUnspecifiedNetworkEvent = "downstream" + websocketUnspecifiedNetworkEvent
-const webSocketTimeout = " websocket connection idle timeout fired after %d seconds"
+const webSocketTimeout = " websocket connection idle timeout fired after %s"
 const upWebsocketTimeoutFired = "upstream" + webSocketTimeout
 const dwnWebsocketTimeoutFired = "downstream" + webSocketTimeout
 const webSocketHangup = " websocket connection hung up TCP socket on us by remote end"
@@ -95,12 +95,18 @@ func upgradeWebsocket(proxy *Proxy) {
 	var status = make(chan WebsocketStatus)
 	var tx *WebsocketTx = &WebsocketTx{}
 
+	//deferred first so the session only ends for graceful shutdown after close frames were sent.
+	endSession := func() {}
+	defer func() {
+		endSession()
+	}()
+
 	//dialer uses TLSInsecureSkipVerify to accept any certificate or host name.
 	dialer := ws.Dialer{
-		Timeout: time.Duration(Runner.Connection.Upstream.SocketTimeoutSeconds) * time.Second,
+		Timeout: proxy.upstreamSocketTimeout(),
 		NetDial: nil,
 		TLSConfig: &tls.Config{
-			InsecureSkipVerify: Runner.Connection.Upstream.TlsInsecureSkipVerify,
+			InsecureSkipVerify: proxy.runtime().Connection.Upstream.TlsInsecureSkipVerify,
 		},
 	}
 
@@ -110,7 +116,7 @@ func upgradeWebsocket(proxy *Proxy) {
 	//configure keepAlive on upstream TCP socket connection
 	if tcpc, tcpct := upCon.(*net.TCPConn); tcpct {
 		tcpc.SetKeepAlive(true)
-		tcpc.SetKeepAlivePeriod(getKeepAliveIntervalDuration())
+		tcpc.SetKeepAlivePeriod(getKeepAliveIntervalDuration(proxy.runtime().Connection.Upstream))
 	}
 
 	defer func() {
@@ -163,6 +169,7 @@ func upgradeWebsocket(proxy *Proxy) {
 			//after sending close frame we are not expected to process any other frames and tear down socket.
 			//See: https://tools.ietf.org/html/rfc6455#section-5.5.1
 			dwnCon.Close()
+			proxy.observeWebsocketSession(-1)
 
 			elapsed := time.Since(proxy.Dwn.startDate)
 			ev := proxy.scaffoldWebsocketLog(log.Info(), elapsed.Microseconds())
@@ -185,13 +192,21 @@ func upgradeWebsocket(proxy *Proxy) {
 
 		return
 	} else {
+		proxy.observeWebsocketSession(1)
 		proxy.scaffoldWebsocketLog(log.Info()).Msg(dwnConUpgraded)
 	}
+	endSession = proxy.runtime().Drainer.sessionStarted()
 
 	go readDwnWebsocket(dwnCon, upCon, proxy, status, tx)
 	go readUpWebsocket(dwnCon, upCon, proxy, status, tx)
 
-	proxy.logWebsocketConnectionExitStatus(<-status)
+	select {
+	case s := <-status:
+		proxy.logWebsocketConnectionExitStatus(s)
+	case <-proxy.runtime().Drainer.isDraining():
+		//the deferred funcs send close frames to both ends.
+		proxy.scaffoldWebsocketLog(log.Info()).Msg(dwnWebsocketDraining)
+	}
 }
 
 const EOF = "EOF"
@@ -217,7 +232,7 @@ func (proxy *Proxy) logWebsocketConnectionExitStatus(conStat WebsocketStatus) {
 	ev := proxy.scaffoldWebsocketLog(log.Trace())
 	if conStat.UpExit != nil {
 		if isTimeout(conStat.UpExit) {
-			ev.Msgf(upWebsocketTimeoutFired, Runner.Connection.Upstream.IdleTimeoutSeconds)
+			ev.Msgf(upWebsocketTimeoutFired, proxy.upstreamIdleTimeout())
 		} else if isHangup(conStat.UpExit) {
 			ev.Msg(upWebSocketHangup)
 		} else if isCloseRequested(conStat.UpExit) {
@@ -230,7 +245,7 @@ func (proxy *Proxy) logWebsocketConnectionExitStatus(conStat WebsocketStatus) {
 	}
 	if conStat.DwnExit != nil {
 		if isTimeout(conStat.DwnExit) {
-			ev.Msgf(dwnWebsocketTimeoutFired, Runner.Connection.Downstream.IdleTimeoutSeconds)
+			ev.Msgf(dwnWebsocketTimeoutFired, proxy.runtime().Connection.Downstream.idleTimeoutDuration())
 		} else if isHangup(conStat.DwnExit) {
 			ev.Msg(dwnWebSocketHangup)
 		} else if isCloseRequested(conStat.DwnExit) {
@@ -247,12 +262,12 @@ func scaffoldHTTPUpgrader(proxy *Proxy) ws.HTTPUpgrader {
 	var h = make(map[string][]string)
 	h[Server] = []string{serverVersion()}
 	h[XRequestID] = []string{proxy.XRequestID}
-	if Runner.isTLSOn() {
+	if proxy.runtime().isTLSOn() {
 		h[strictTransportSecurity] = []string{maxAge31536000}
 	}
 
 	upg := ws.HTTPUpgrader{
-		Timeout: time.Second * time.Duration(Runner.Connection.Downstream.ReadTimeoutSeconds),
+		Timeout: proxy.runtime().Connection.Downstream.readTimeoutDuration(),
 		Header:  h,
 	}
 	return upg
@@ -261,13 +276,13 @@ func scaffoldHTTPUpgrader(proxy *Proxy) ws.HTTPUpgrader {
 func readDwnWebsocket(dwnCon net.Conn, upCon net.Conn, proxy *Proxy, status chan<- WebsocketStatus, tx *WebsocketTx) {
 ReadDwn:
 	for {
-		dwnCon.SetDeadline(time.Now().Add(time.Second * time.Duration(Runner.Connection.Downstream.IdleTimeoutSeconds)))
+		dwnCon.SetDeadline(time.Now().Add(proxy.runtime().Connection.Downstream.idleTimeoutDuration()))
 		msg, op, dre := wsutil.ReadClientData(dwnCon)
 		if dre == nil {
 			lm := int64(len(msg))
 			tx.DwnBytesRead += lm
 
-			upCon.SetDeadline(time.Now().Add(time.Second * time.Duration(Runner.Connection.Upstream.IdleTimeoutSeconds)))
+			upCon.SetDeadline(time.Now().Add(proxy.upstreamIdleTimeout()))
 			uwe := wsutil.WriteClientMessage(upCon, op, msg)
 			if uwe == nil {
 				tx.UpBytesWrite += lm
@@ -299,14 +314,14 @@ ReadDwn:
 func readUpWebsocket(dwnCon net.Conn, upCon net.Conn, proxy *Proxy, status chan<- WebsocketStatus, tx *WebsocketTx) {
 ReadUp:
 	for {
-		upCon.SetDeadline(time.Now().Add(time.Second * time.Duration(Runner.Connection.Upstream.IdleTimeoutSeconds)))
+		upCon.SetDeadline(time.Now().Add(proxy.upstreamIdleTimeout()))
 		msg, op, ure := wsutil.ReadServerData(upCon)
 		if ure == nil {
 			lm := int64(len(msg))
 			tx.UpBytesRead += lm
 
 			//we must set both deadlines inside the loop to keep updating timeouts
-			dwnCon.SetDeadline(time.Now().Add(time.Second * time.Duration(Runner.Connection.Downstream.IdleTimeoutSeconds)))
+			dwnCon.SetDeadline(time.Now().Add(proxy.runtime().Connection.Downstream.idleTimeoutDuration()))
 			dwe := wsutil.WriteServerMessage(dwnCon, op, msg)
 			if dwe == nil {
 				tx.DwnBytesWrite += lm